@@ -19,6 +19,8 @@ package aws
 import (
 	"fmt"
 	"os"
+	"strings"
+	"time"
 
 	awsops "github.com/libopenstorage/openstorage/pkg/storageops/aws"
 	"github.com/libopenstorage/rico/pkg/cloudprovider"
@@ -30,9 +32,47 @@ import (
 	"go.pedge.io/dlog"
 )
 
+const (
+	// Volume attachment limit for Nitro instances. This limit is shared
+	// with network interfaces and instance store volumes.
+	nitroAttachmentLimit = 28
+
+	// Recommended volume attachment limit for Xen instances
+	xenAttachmentLimit = 40
+
+	// Tag added to the volumes created by rico
+	createdByTag   = "created-by"
+	createdByValue = "rico"
+
+	// Tag with the cluster which owns the volume, so that managers of
+	// other clusters in the same account never list or delete it
+	clusterTag = "rico-cluster-id"
+
+	// How long to wait for AWS to start optimizing a resized volume
+	resizeTimeout = 5 * time.Minute
+
+	// How often to check the modification state of a resized volume
+	resizeInterval = 5 * time.Second
+)
+
+// Instance families which run on the Xen hypervisor. All other families,
+// including ones released after this list, are counted with the lower
+// Nitro limit so that attachments never fail.
+var xenFamilies = map[string]bool{
+	"c1": true, "c3": true, "c4": true, "cc2": true, "cr1": true,
+	"d2": true, "f1": true, "g2": true, "g3": true, "g3s": true,
+	"h1": true, "hi1": true, "hs1": true, "i2": true, "i3": true,
+	"m1": true, "m2": true, "m3": true, "m4": true, "p2": true,
+	"p3": true, "r3": true, "r4": true, "t1": true, "t2": true,
+	"x1": true, "x1e": true,
+}
+
 // Provider has the client and state information to communicate with AWS
 type Provider struct {
 	ec2c *ec2.EC2
+
+	// Labels of the volumes created by this provider
+	labels map[string]string
 }
 
 // NewProvider provides an implementation of cloudprovider.Instance
@@ -44,6 +84,11 @@ func NewProvider() *Provider {
 		dlog.Errorf("AWS_DEFAULT_REGION not defined")
 		return nil
 	}
+	clusterID := os.Getenv("RICO_CLUSTER_ID")
+	if len(clusterID) == 0 {
+		dlog.Errorf("RICO_CLUSTER_ID not defined")
+		return nil
+	}
 
 	// Create a session
 	// TODO: When running in Kubernetes, look at how they do it.
@@ -57,7 +102,17 @@ func NewProvider() *Provider {
 	}
 
 	return &Provider{
-		ec2c: ec2c,
+		ec2c:   ec2c,
+		labels: clusterLabels(clusterID),
+	}
+}
+
+// clusterLabels returns the labels of the volumes created by rico for
+// the cluster
+func clusterLabels(clusterID string) map[string]string {
+	return map[string]string{
+		createdByTag: createdByValue,
+		clusterTag:   clusterID,
 	}
 }
 
@@ -102,7 +157,7 @@ func (p *Provider) DeviceCreate(
 		return nil, err
 	}
 
-	d, err := ops.Create(volreq, nil)
+	d, err := ops.Create(volreq, p.labels)
 	if err != nil {
 		return nil, fmt.Errorf("Failed to create volume: %v", err)
 	}
@@ -122,11 +177,15 @@ func (p *Provider) DeviceCreate(
 		return nil, reterr
 	}
 
-	return &cloudprovider.Device{
+	cloudDevice := &cloudprovider.Device{
 		ID:   *vol.VolumeId,
 		Path: path,
 		Size: uint64(*vol.Size),
-	}, nil
+	}
+	if vol.CreateTime != nil {
+		cloudDevice.Created = *vol.CreateTime
+	}
+	return cloudDevice, nil
 }
 
 // DeviceDelete detaches the volume from the specified node, then deletes it
@@ -135,11 +194,13 @@ func (p *Provider) DeviceDelete(instanceID string, deviceID string) error {
 	ops := awsops.NewEc2Storage(instanceID, p.ec2c)
 
 	// Detach volume
-	if err := ops.Detach(deviceID); err != nil {
-		return fmt.Errorf("Failed to detach volume %s from instance %s: %v",
-			deviceID,
-			instanceID,
-			err)
+	if len(instanceID) != 0 {
+		if err := ops.Detach(deviceID); err != nil {
+			return fmt.Errorf("Failed to detach volume %s from instance %s: %v",
+				deviceID,
+				instanceID,
+				err)
+		}
 	}
 
 	// Delete volume
@@ -151,3 +212,127 @@ func (p *Provider) DeviceDelete(instanceID string, deviceID string) error {
 
 	return nil
 }
+
+// DeviceResize grows the volume to the size in GiB. It returns once AWS
+// has moved the modification to the optimizing or completed state, after
+// which the volume can be used with its new size.
+func (p *Provider) DeviceResize(instanceID string, deviceID string, size uint64) error {
+	newSize := int64(size)
+	_, err := p.ec2c.ModifyVolume(&ec2.ModifyVolumeInput{
+		VolumeId: &deviceID,
+		Size:     &newSize,
+	})
+	if err != nil {
+		return fmt.Errorf("Failed to resize volume %s on instance %s to %d GiB: %v",
+			deviceID,
+			instanceID,
+			size,
+			err)
+	}
+
+	deadline := time.Now().Add(resizeTimeout)
+	for {
+		state, err := p.modificationState(deviceID)
+		if err != nil {
+			return err
+		}
+		switch state {
+		case ec2.VolumeModificationStateOptimizing,
+			ec2.VolumeModificationStateCompleted:
+			return nil
+		case ec2.VolumeModificationStateFailed:
+			return fmt.Errorf("Failed to resize volume %s on instance %s to %d GiB: modification failed",
+				deviceID,
+				instanceID,
+				size)
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("Timed out resizing volume %s on instance %s to %d GiB: modification is %s",
+				deviceID,
+				instanceID,
+				size,
+				state)
+		}
+		time.Sleep(resizeInterval)
+	}
+}
+
+// modificationState returns the state of the latest modification of the volume
+func (p *Provider) modificationState(deviceID string) (string, error) {
+	output, err := p.ec2c.DescribeVolumesModifications(&ec2.DescribeVolumesModificationsInput{
+		VolumeIds: []*string{&deviceID},
+	})
+	if err != nil {
+		return "", fmt.Errorf("Failed to get the modification state of volume %s: %v",
+			deviceID,
+			err)
+	}
+	if len(output.VolumesModifications) == 0 {
+		return ec2.VolumeModificationStateModifying, nil
+	}
+	return aws.StringValue(output.VolumesModifications[0].ModificationState), nil
+}
+
+// DeviceList returns the volumes created by rico for the cluster
+func (p *Provider) DeviceList() ([]*cloudprovider.Device, error) {
+	ops := awsops.NewEc2Storage("", p.ec2c)
+	sets, err := ops.Enumerate(nil, p.labels, "")
+	if err != nil {
+		return nil, fmt.Errorf("Failed to list volumes: %v", err)
+	}
+
+	devices := make([]*cloudprovider.Device, 0)
+	for _, set := range sets {
+		for _, v := range set {
+			vol := v.(*ec2.Volume)
+			device := &cloudprovider.Device{
+				ID: *vol.VolumeId,
+			}
+			if vol.Size != nil {
+				device.Size = uint64(*vol.Size)
+			}
+			if vol.CreateTime != nil {
+				device.Created = *vol.CreateTime
+			}
+			for _, attachment := range vol.Attachments {
+				if attachment.InstanceId != nil {
+					device.InstanceID = *attachment.InstanceId
+				}
+				if attachment.Device != nil {
+					device.Path = *attachment.Device
+				}
+			}
+			devices = append(devices, device)
+		}
+	}
+	return devices, nil
+}
+
+// AttachmentCapacity returns the number of volumes which can still be
+// attached to the instance
+func (p *Provider) AttachmentCapacity(instanceID string) (int, error) {
+	ops := awsops.NewEc2Storage(instanceID, p.ec2c)
+	descriptionI, err := ops.Describe()
+	if err != nil {
+		return 0, err
+	}
+	description := descriptionI.(*ec2.Instance)
+
+	limit := xenAttachmentLimit
+	if description.InstanceType != nil && isNitro(*description.InstanceType) {
+		limit = nitroAttachmentLimit - len(description.NetworkInterfaces)
+	}
+
+	capacity := limit - len(description.BlockDeviceMappings)
+	if capacity < 0 {
+		capacity = 0
+	}
+	return capacity, nil
+}
+
+// isNitro returns true if the instance type is built on the Nitro system
+// or is not known to run on Xen
+func isNitro(instanceType string) bool {
+	family := strings.Split(instanceType, ".")[0]
+	return !xenFamilies[family]
+}
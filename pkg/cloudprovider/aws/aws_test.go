@@ -36,6 +36,10 @@ import (
 	 tr '\n' ' ' | \
 	 sed -e "s#\"##g" -e "s# #,#g" -e 's#.$##')
 
+ The volumes are tagged with the cluster in RICO_CLUSTER_ID:
+
+ export RICO_CLUSTER_ID=rico-test
+
 */
 
 func TestAwsDeviceAddDelete(t *testing.T) {
@@ -114,3 +118,41 @@ func TestAwsDeviceAddDelete(t *testing.T) {
 		assert.False(t, found)
 	}
 }
+
+func TestIsNitro(t *testing.T) {
+	tests := []struct {
+		instanceType string
+		nitro        bool
+	}{
+		{"t2.micro", false},
+		{"m4.xlarge", false},
+		{"i3.large", false},
+		{"t3.micro", true},
+		{"c5d.2xlarge", true},
+		{"m6i.large", true},
+		{"c7g.medium", true},
+		{"t4g.micro", true},
+		{"m5zn.large", true},
+		{"r5b.xlarge", true},
+		{"g5.xlarge", true},
+		{"inf2.xlarge", true},
+		{"trn1.2xlarge", true},
+		{"x2idn.16xlarge", true},
+		{"d3.xlarge", true},
+		{"p3dn.24xlarge", true},
+		{"i3en.large", true},
+		{"x1e.xlarge", false},
+		{"p3.2xlarge", false},
+		{"d2.xlarge", false},
+		{"unknown", true},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.nitro, isNitro(test.instanceType), test.instanceType)
+	}
+}
+
+func TestClusterLabels(t *testing.T) {
+	labels := clusterLabels("cluster-1")
+	assert.Equal(t, createdByValue, labels[createdByTag])
+	assert.Equal(t, "cluster-1", labels[clusterTag])
+}
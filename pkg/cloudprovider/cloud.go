@@ -17,6 +17,10 @@ limitations under the License.
 //go:generate mockgen -package=mock -destination=mock/cloud.mock.go github.com/libopenstorage/rico/pkg/cloudprovider Interface
 package cloudprovider
 
+import (
+	"time"
+)
+
 // DeviceSpecs specifies the type of drive to create
 type DeviceSpecs struct {
 	// Size in GiB
@@ -37,6 +41,13 @@ type Device struct {
 
 	// Size in GiB
 	Size uint64
+
+	// Created is the time the device was created
+	Created time.Time
+
+	// InstanceID of the instance the device is attached to. It is
+	// only set by DeviceList and is empty if the device is detached.
+	InstanceID string
 }
 
 // Interface provides a pluggable interface for cloud providers
@@ -45,6 +56,19 @@ type Interface interface {
 	// the id of the newly created device
 	DeviceCreate(instanceID string, device *DeviceSpecs) (*Device, error)
 
-	// DeviceDelete detaches and deletes a cloud block device from a node
+	// DeviceDelete detaches and deletes a cloud block device from a node.
+	// Devices which are not attached have an empty instance ID.
 	DeviceDelete(instanceID string, deviceID string) error
+
+	// DeviceResize grows an attached device to the size in GiB
+	DeviceResize(instanceID string, deviceID string, size uint64) error
+
+	// DeviceList returns the devices created by DeviceCreate which have
+	// not been deleted
+	DeviceList() ([]*Device, error)
+
+	// AttachmentCapacity returns the number of additional devices which
+	// can be attached to the instance. A negative value means the
+	// instance has no limit.
+	AttachmentCapacity(instanceID string) (int, error)
 }
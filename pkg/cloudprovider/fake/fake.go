@@ -0,0 +1,171 @@
+/*
+Package fake provides a fake implementation of the cloud interface to
+be used for testing.
+Copyright 2018 Portworx
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package fake
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/libopenstorage/rico/pkg/cloudprovider"
+)
+
+// This is for tests only
+
+// Fake is an memory-only implementation of the cloudprovider.Interface
+type Fake struct {
+	// Devices holds the devices attached to each instance
+	Devices map[string][]*cloudprovider.Device
+
+	// AttachmentLimit is the maximum number of devices per instance.
+	// Zero means there is no limit.
+	AttachmentLimit int
+
+	// DeleteError is returned by DeviceDelete when set
+	DeleteError error
+
+	// CreateErrors are returned by DeviceCreate for the instance when set
+	CreateErrors map[string]error
+
+	// Cluster is the cluster of the devices created by this provider.
+	// DeviceList only returns the devices of this cluster.
+	Cluster string
+
+	// Clusters holds the cluster of each device
+	Clusters map[string]string
+
+	lock   sync.Mutex
+	nextID int
+}
+
+// New returns a new Fake cloud implementation
+func New() *Fake {
+	return &Fake{
+		Devices:  make(map[string][]*cloudprovider.Device),
+		Clusters: make(map[string]string),
+	}
+}
+
+// DeviceCreate creates a device in memory and attaches it to the instance
+func (f *Fake) DeviceCreate(
+	instanceID string,
+	device *cloudprovider.DeviceSpecs,
+) (*cloudprovider.Device, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if err := f.CreateErrors[instanceID]; err != nil {
+		return nil, err
+	}
+	if f.AttachmentLimit > 0 && len(f.Devices[instanceID]) >= f.AttachmentLimit {
+		return nil, fmt.Errorf("Instance %s cannot attach more devices", instanceID)
+	}
+
+	f.nextID++
+	d := &cloudprovider.Device{
+		ID:      fmt.Sprintf("vol-%d", f.nextID),
+		Path:    fmt.Sprintf("/dev/fake%d", f.nextID),
+		Size:    device.Size,
+		Created: time.Now(),
+	}
+	f.Devices[instanceID] = append(f.Devices[instanceID], d)
+	f.Clusters[d.ID] = f.Cluster
+	return d, nil
+}
+
+// DeviceDelete detaches and removes the device from memory
+func (f *Fake) DeviceDelete(instanceID string, deviceID string) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if f.DeleteError != nil {
+		return f.DeleteError
+	}
+
+	devices := f.Devices[instanceID]
+	for i, d := range devices {
+		if d.ID == deviceID {
+			f.Devices[instanceID] = append(devices[:i], devices[i+1:]...)
+			return nil
+		}
+	}
+	return fmt.Errorf("Device %s not found on instance %s", deviceID, instanceID)
+}
+
+// DeviceResize changes the size of the device in memory
+func (f *Fake) DeviceResize(instanceID string, deviceID string, size uint64) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	for _, d := range f.Devices[instanceID] {
+		if d.ID == deviceID {
+			if size < d.Size {
+				return fmt.Errorf("Device %s cannot shrink from %d to %d GiB",
+					deviceID,
+					d.Size,
+					size)
+			}
+			d.Size = size
+			return nil
+		}
+	}
+	return fmt.Errorf("Device %s not found on instance %s", deviceID, instanceID)
+}
+
+// DeviceList returns the devices of the cluster in memory
+func (f *Fake) DeviceList() ([]*cloudprovider.Device, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	list := make([]*cloudprovider.Device, 0)
+	for instanceID, devices := range f.Devices {
+		for _, d := range devices {
+			if f.Clusters[d.ID] != f.Cluster {
+				continue
+			}
+			device := *d
+			device.InstanceID = instanceID
+			list = append(list, &device)
+		}
+	}
+	return list, nil
+}
+
+// AttachmentCapacity returns the number of devices which can still be
+// attached to the instance
+func (f *Fake) AttachmentCapacity(instanceID string) (int, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if f.AttachmentLimit <= 0 {
+		return -1, nil
+	}
+	return f.AttachmentLimit - len(f.Devices[instanceID]), nil
+}
+
+// NumDevices returns the total number of devices in the Fake cloud
+func (f *Fake) NumDevices() int {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	devices := 0
+	for _, d := range f.Devices {
+		devices += len(d)
+	}
+	return devices
+}
@@ -33,6 +33,19 @@ func (m *MockInterface) EXPECT() *MockInterfaceMockRecorder {
 	return m.recorder
 }
 
+// AttachmentCapacity mocks base method
+func (m *MockInterface) AttachmentCapacity(arg0 string) (int, error) {
+	ret := m.ctrl.Call(m, "AttachmentCapacity", arg0)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// AttachmentCapacity indicates an expected call of AttachmentCapacity
+func (mr *MockInterfaceMockRecorder) AttachmentCapacity(arg0 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AttachmentCapacity", reflect.TypeOf((*MockInterface)(nil).AttachmentCapacity), arg0)
+}
+
 // DeviceCreate mocks base method
 func (m *MockInterface) DeviceCreate(arg0 string, arg1 *cloudprovider.DeviceSpecs) (*cloudprovider.Device, error) {
 	ret := m.ctrl.Call(m, "DeviceCreate", arg0, arg1)
@@ -57,3 +70,28 @@ func (m *MockInterface) DeviceDelete(arg0, arg1 string) error {
 func (mr *MockInterfaceMockRecorder) DeviceDelete(arg0, arg1 interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeviceDelete", reflect.TypeOf((*MockInterface)(nil).DeviceDelete), arg0, arg1)
 }
+
+// DeviceList mocks base method
+func (m *MockInterface) DeviceList() ([]*cloudprovider.Device, error) {
+	ret := m.ctrl.Call(m, "DeviceList")
+	ret0, _ := ret[0].([]*cloudprovider.Device)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DeviceList indicates an expected call of DeviceList
+func (mr *MockInterfaceMockRecorder) DeviceList() *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeviceList", reflect.TypeOf((*MockInterface)(nil).DeviceList))
+}
+
+// DeviceResize mocks base method
+func (m *MockInterface) DeviceResize(arg0, arg1 string, arg2 uint64) error {
+	ret := m.ctrl.Call(m, "DeviceResize", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeviceResize indicates an expected call of DeviceResize
+func (mr *MockInterfaceMockRecorder) DeviceResize(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeviceResize", reflect.TypeOf((*MockInterface)(nil).DeviceResize), arg0, arg1, arg2)
+}
@@ -0,0 +1,165 @@
+/*
+Package inframanager provides an interface to the infrastrcture manager
+Copyright 2018 Portworx
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package inframanager
+
+import (
+	"fmt"
+
+	"github.com/libopenstorage/rico/pkg/storageprovider"
+)
+
+// LabelOperator is the relationship between a label and a set of values
+type LabelOperator string
+
+const (
+	// LabelOpIn matches when the label has one of the values
+	LabelOpIn LabelOperator = "In"
+
+	// LabelOpNotIn matches when the label is missing or has none of
+	// the values
+	LabelOpNotIn LabelOperator = "NotIn"
+
+	// LabelOpExists matches when the label is present
+	LabelOpExists LabelOperator = "Exists"
+
+	// LabelOpDoesNotExist matches when the label is missing
+	LabelOpDoesNotExist LabelOperator = "DoesNotExist"
+)
+
+// LabelRequirement is a rule matched against the labels of a node
+type LabelRequirement struct {
+	// Key of the label
+	Key string
+
+	// Operator applied to the label
+	Operator LabelOperator
+
+	// Values used by LabelOpIn and LabelOpNotIn
+	Values []string
+}
+
+// PreferredLabelRequirement is a rule which adds its weight to the
+// nodes it matches
+type PreferredLabelRequirement struct {
+	LabelRequirement
+
+	// Weight added for each node matching the rule
+	Weight int
+}
+
+// NodeAffinity is a set of rules matched against the labels of a node
+type NodeAffinity struct {
+	// Required rules must all match
+	Required []LabelRequirement
+
+	// Preferred rules are used to rank the nodes
+	Preferred []PreferredLabelRequirement
+}
+
+// Matches returns true if the labels satisfy the requirement
+func (r *LabelRequirement) Matches(labels map[string]string) bool {
+	value, ok := labels[r.Key]
+	switch r.Operator {
+	case LabelOpIn:
+		return ok && contains(r.Values, value)
+	case LabelOpNotIn:
+		return !ok || !contains(r.Values, value)
+	case LabelOpExists:
+		return ok
+	case LabelOpDoesNotExist:
+		return !ok
+	}
+	return false
+}
+
+func (r *LabelRequirement) validate() error {
+	switch r.Operator {
+	case LabelOpIn, LabelOpNotIn:
+		if len(r.Values) == 0 {
+			return fmt.Errorf("Operator %s on label %s requires values",
+				r.Operator,
+				r.Key)
+		}
+	case LabelOpExists, LabelOpDoesNotExist:
+	default:
+		return fmt.Errorf("Unknown operator %s on label %s", r.Operator, r.Key)
+	}
+	return nil
+}
+
+func (a *NodeAffinity) validate() error {
+	for i := range a.Required {
+		if err := a.Required[i].validate(); err != nil {
+			return err
+		}
+	}
+	for i := range a.Preferred {
+		if err := a.Preferred[i].validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// NodeAllowed returns true if the node satisfies the node selector and
+// the required affinity and anti-affinity rules of the class
+func (c *Class) NodeAllowed(node *storageprovider.StorageNode) bool {
+	for key, value := range c.NodeSelector {
+		if v, ok := node.Labels[key]; !ok || v != value {
+			return false
+		}
+	}
+	for i := range c.Affinity.Required {
+		if !c.Affinity.Required[i].Matches(node.Labels) {
+			return false
+		}
+	}
+	for i := range c.AntiAffinity.Required {
+		if c.AntiAffinity.Required[i].Matches(node.Labels) {
+			return false
+		}
+	}
+	return true
+}
+
+// AffinityScore returns the sum of the weights of the preferred affinity
+// rules matching the node minus the weights of the preferred
+// anti-affinity rules matching it. Nodes with higher scores are
+// preferred for new devices.
+func (c *Class) AffinityScore(node *storageprovider.StorageNode) int {
+	score := 0
+	for i := range c.Affinity.Preferred {
+		if c.Affinity.Preferred[i].Matches(node.Labels) {
+			score += c.Affinity.Preferred[i].Weight
+		}
+	}
+	for i := range c.AntiAffinity.Preferred {
+		if c.AntiAffinity.Preferred[i].Matches(node.Labels) {
+			score -= c.AntiAffinity.Preferred[i].Weight
+		}
+	}
+	return score
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
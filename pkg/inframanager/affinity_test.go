@@ -0,0 +1,101 @@
+/*
+Package inframanager provides an interface to the infrastrcture manager
+Copyright 2018 Portworx
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package inframanager
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	cloudfake "github.com/libopenstorage/rico/pkg/cloudprovider/fake"
+	"github.com/libopenstorage/rico/pkg/storageprovider"
+	"github.com/libopenstorage/rico/pkg/storageprovider/fake"
+)
+
+func TestLabelRequirement(t *testing.T) {
+	labels := map[string]string{"tier": "fast", "gpu": "true"}
+	tests := []struct {
+		requirement LabelRequirement
+		matches     bool
+	}{
+		{LabelRequirement{"tier", LabelOpIn, []string{"fast", "medium"}}, true},
+		{LabelRequirement{"tier", LabelOpIn, []string{"slow"}}, false},
+		{LabelRequirement{"tier", LabelOpNotIn, []string{"slow"}}, true},
+		{LabelRequirement{"zone", LabelOpNotIn, []string{"a"}}, true},
+		{LabelRequirement{"gpu", LabelOpExists, nil}, true},
+		{LabelRequirement{"gpu", LabelOpDoesNotExist, nil}, false},
+		{LabelRequirement{"gpu", "Bad", nil}, false},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.matches, test.requirement.Matches(labels), test.requirement)
+	}
+
+	assert.Error(t, (&LabelRequirement{"tier", LabelOpIn, nil}).validate())
+	assert.Error(t, (&LabelRequirement{"tier", "Bad", nil}).validate())
+	assert.NoError(t, (&LabelRequirement{"tier", LabelOpExists, nil}).validate())
+}
+
+func TestAddStorageAffinity(t *testing.T) {
+	nodes := newTestNodes("i-1", "i-2", "i-3", "i-4")
+	nodes[0].Labels = map[string]string{"tier": "slow"}
+	nodes[1].Labels = map[string]string{"tier": "fast", "gpu": "true"}
+	nodes[2].Labels = map[string]string{"tier": "fast"}
+	nodes[3].Labels = map[string]string{"tier": "fast", "maintenance": "true"}
+	storage := fake.New(&storageprovider.Topology{
+		Cluster: storageprovider.StorageCluster{
+			StorageNodes: nodes,
+		},
+	})
+	storage.CurrentUtilization = 80
+	class := Class{
+		Name:          "io1",
+		WatermarkHigh: 75,
+		DiskSets:      1,
+		DiskSizeGb:    8,
+		NodeSelector:  map[string]string{"tier": "fast"},
+		AntiAffinity: NodeAffinity{
+			Required: []LabelRequirement{
+				{Key: "maintenance", Operator: LabelOpExists},
+			},
+			Preferred: []PreferredLabelRequirement{
+				{
+					LabelRequirement: LabelRequirement{
+						Key:      "gpu",
+						Operator: LabelOpIn,
+						Values:   []string{"true"},
+					},
+					Weight: 10,
+				},
+			},
+		},
+	}
+	assert.NoError(t, class.validate())
+	im := NewManager(&Config{Classes: []Class{class}}, cloudfake.New(), storage)
+
+	// Nodes without gpu are preferred even when they have more devices
+	for i := 0; i < 2; i++ {
+		assert.NoError(t, im.do(&class))
+	}
+	assert.Len(t, nodes[0].Devices, 0)
+	assert.Len(t, nodes[1].Devices, 0)
+	assert.Len(t, nodes[2].Devices, 2)
+	assert.Len(t, nodes[3].Devices, 0)
+
+	// Nothing matches the selector
+	class.NodeSelector = map[string]string{"tier": "archive"}
+	assert.Error(t, im.do(&class))
+}
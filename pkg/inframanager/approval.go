@@ -0,0 +1,203 @@
+/*
+Package inframanager provides an interface to the infrastrcture manager
+Copyright 2018 Portworx
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package inframanager
+
+import (
+	"fmt"
+	"time"
+
+	"go.pedge.io/dlog"
+)
+
+// Default time a class waits after a rejected plan
+const defaultRejectCooldown = time.Hour
+
+// ApprovalConfig gates the changes to a class on approval
+type ApprovalConfig struct {
+	// Required queues the plans of the class until they are approved
+	// or rejected
+	Required bool
+
+	// AutoApproveBelowGb applies plans which create, grow and delete
+	// less than this many GiB without waiting for approval
+	AutoApproveBelowGb uint64
+
+	// Timeout is how long a plan waits for approval before it expires.
+	// Plans never expire if not set.
+	Timeout time.Duration
+
+	// RejectCooldown is how long the class waits after a plan is
+	// rejected before it proposes another one. Defaults to one hour.
+	RejectCooldown time.Duration
+}
+
+func (a *ApprovalConfig) validate() error {
+	if a.Timeout < 0 {
+		return fmt.Errorf("Timeout must not be negative")
+	}
+	if a.RejectCooldown < 0 {
+		return fmt.Errorf("RejectCooldown must not be negative")
+	}
+	return nil
+}
+
+// rejectCooldown returns how long the class waits after a rejection
+func (a *ApprovalConfig) rejectCooldown() time.Duration {
+	if a.RejectCooldown == 0 {
+		return defaultRejectCooldown
+	}
+	return a.RejectCooldown
+}
+
+// PendingPlan is a plan waiting for approval
+type PendingPlan struct {
+	Plan *Plan
+
+	// Queued is when the plan was queued
+	Queued time.Time
+
+	// Expires is when the plan will be dropped if not approved. It is
+	// zero if the plan never expires.
+	Expires time.Time
+}
+
+// PendingPlans returns the plans waiting for approval
+func (m *Manager) PendingPlans() []*PendingPlan {
+	plans := make([]*PendingPlan, 0)
+	for _, state := range m.classStates() {
+		state.lock.Lock()
+		if state.pending != nil {
+			pending := *state.pending
+			pending.Plan = pending.Plan.copy()
+			plans = append(plans, &pending)
+		}
+		state.lock.Unlock()
+	}
+	return plans
+}
+
+// Approve applies the pending plan with the ID
+func (m *Manager) Approve(id string) error {
+	state, err := m.pendingState(id)
+	if err != nil {
+		return err
+	}
+	defer state.lock.Unlock()
+
+	plan := state.pending.Plan
+	class, err := m.class(plan.Class)
+	if err != nil {
+		return err
+	}
+	state.pending = nil
+	state.status.PendingPlan = ""
+	dlog.Infof("Plan %s of class %s approved", plan.ID, plan.Class)
+	return m.applyPlan(class, state, plan)
+}
+
+// Reject drops the pending plan with the ID
+func (m *Manager) Reject(id, reason string) error {
+	state, err := m.pendingState(id)
+	if err != nil {
+		return err
+	}
+	defer state.lock.Unlock()
+
+	plan := state.pending.Plan
+	state.pending = nil
+	state.status.PendingPlan = ""
+	if class, err := m.class(plan.Class); err == nil {
+		state.status.RejectedUntil = m.now().Add(class.Approval.rejectCooldown())
+	}
+	dlog.Infof("Plan %s of class %s rejected: %s", plan.ID, plan.Class, reason)
+	return nil
+}
+
+// rejected returns true if the class still waits after a rejected plan
+func (m *Manager) rejected(state *classState) bool {
+	return m.now().Before(state.status.RejectedUntil)
+}
+
+// pendingState returns the locked state of the class with the pending
+// plan. Expired plans are dropped.
+func (m *Manager) pendingState(id string) (*classState, error) {
+	for _, state := range m.classStates() {
+		state.lock.Lock()
+		if state.pending != nil && state.pending.Plan.ID == id {
+			if m.expired(state) {
+				state.lock.Unlock()
+				return nil, fmt.Errorf("Plan %s expired", id)
+			}
+			return state, nil
+		}
+		state.lock.Unlock()
+	}
+	return nil, fmt.Errorf("Plan %s is not pending", id)
+}
+
+// needsApproval returns true if the plan must wait for approval
+func needsApproval(class *Class, plan *Plan) bool {
+	if !class.Approval.Required || len(plan.Steps) == 0 {
+		return false
+	}
+	return planSize(plan) >= class.Approval.AutoApproveBelowGb
+}
+
+// queue keeps the plan until it is approved or rejected
+func (m *Manager) queue(class *Class, state *classState, plan *Plan) {
+	pending := &PendingPlan{
+		Plan:   plan,
+		Queued: m.now(),
+	}
+	if class.Approval.Timeout > 0 {
+		pending.Expires = pending.Queued.Add(class.Approval.Timeout)
+	}
+	state.pending = pending
+	state.status.PendingPlan = plan.ID
+	dlog.Infof("Plan %s of class %s is waiting for approval", plan.ID, class.Name)
+}
+
+// expired drops the pending plan of the class and returns true if it
+// timed out
+func (m *Manager) expired(state *classState) bool {
+	if state.pending == nil ||
+		state.pending.Expires.IsZero() ||
+		m.now().Before(state.pending.Expires) {
+		return false
+	}
+
+	dlog.Infof("Plan %s of class %s expired",
+		state.pending.Plan.ID,
+		state.pending.Plan.Class)
+	state.pending = nil
+	state.status.PendingPlan = ""
+	return true
+}
+
+// planSize returns the GiB created, grown and deleted by the plan
+func planSize(plan *Plan) uint64 {
+	var size uint64
+	for _, step := range plan.Steps {
+		switch step.Action {
+		case StepCreate, StepDelete:
+			size += step.Size
+		case StepResize:
+			size += step.Size - step.PreviousSize
+		}
+	}
+	return size
+}
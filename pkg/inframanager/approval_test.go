@@ -0,0 +1,109 @@
+/*
+Package inframanager provides an interface to the infrastrcture manager
+Copyright 2018 Portworx
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package inframanager
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	cloudfake "github.com/libopenstorage/rico/pkg/cloudprovider/fake"
+	"github.com/libopenstorage/rico/pkg/storageprovider"
+	"github.com/libopenstorage/rico/pkg/storageprovider/fake"
+)
+
+func TestApproval(t *testing.T) {
+	storage := fake.New(&storageprovider.Topology{
+		Cluster: storageprovider.StorageCluster{
+			StorageNodes: newTestNodes("i-1", "i-2"),
+		},
+	})
+	storage.CurrentUtilization = 80
+	class := Class{
+		Name:          "gp2",
+		WatermarkHigh: 75,
+		WatermarkLow:  25,
+		DiskSets:      2,
+		DiskSizeGb:    8,
+		Approval: ApprovalConfig{
+			Required: true,
+			Timeout:  time.Hour,
+		},
+	}
+	im := NewManager(&Config{Classes: []Class{class}}, cloudfake.New(), storage)
+	now := time.Now()
+	im.now = func() time.Time { return now }
+
+	// Only one plan is queued
+	assert.NoError(t, im.do(&class))
+	assert.NoError(t, im.do(&class))
+	assert.Equal(t, 0, storage.NumDevices())
+	pending := im.PendingPlans()
+	assert.Len(t, pending, 1)
+	id := pending[0].Plan.ID
+	assert.Equal(t, now.Add(time.Hour), pending[0].Expires)
+	status, err := im.Status("gp2")
+	assert.NoError(t, err)
+	assert.Equal(t, id, status.PendingPlan)
+
+	// A rejected plan is dropped and not proposed again right away
+	assert.NoError(t, im.Reject(id, "not now"))
+	assert.Len(t, im.PendingPlans(), 0)
+	assert.Error(t, im.Approve(id))
+	assert.NoError(t, im.do(&class))
+	assert.Len(t, im.PendingPlans(), 0)
+	status, err = im.Status("gp2")
+	assert.NoError(t, err)
+	assert.Equal(t, now.Add(time.Hour), status.RejectedUntil)
+	now = now.Add(time.Hour)
+
+	// Expired plans cannot be approved and are replaced
+	assert.NoError(t, im.do(&class))
+	id = im.PendingPlans()[0].Plan.ID
+	now = now.Add(2 * time.Hour)
+	assert.Error(t, im.Approve(id))
+	assert.NoError(t, im.do(&class))
+	pending = im.PendingPlans()
+	assert.Len(t, pending, 1)
+	assert.NotEqual(t, id, pending[0].Plan.ID)
+
+	// Pending plans are only applied by approving them
+	assert.Error(t, im.Apply(pending[0].Plan))
+	plan, err := im.Plan("gp2")
+	assert.NoError(t, err)
+	assert.Error(t, im.Apply(plan))
+	pending[0].Plan.Steps = nil
+	assert.Len(t, im.PendingPlans()[0].Plan.Steps, 6)
+	assert.Equal(t, 0, storage.NumDevices())
+
+	// An approved plan is applied
+	assert.NoError(t, im.Approve(pending[0].Plan.ID))
+	assert.Equal(t, 2, storage.NumDevices())
+	assert.Len(t, im.PendingPlans(), 0)
+	status, err = im.Status("gp2")
+	assert.NoError(t, err)
+	assert.Equal(t, "", status.PendingPlan)
+	assert.Equal(t, now, status.LastScaleUp)
+
+	// Small plans are applied right away
+	class.Approval.AutoApproveBelowGb = 10
+	storage.CurrentUtilization = 10
+	assert.NoError(t, im.do(&class))
+	assert.Equal(t, 1, storage.NumDevices())
+	assert.Len(t, im.PendingPlans(), 0)
+}
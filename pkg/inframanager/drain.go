@@ -0,0 +1,144 @@
+/*
+Package inframanager provides an interface to the infrastrcture manager
+Copyright 2018 Portworx
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package inframanager
+
+import (
+	"sort"
+	"time"
+
+	"go.pedge.io/dlog"
+
+	"github.com/libopenstorage/rico/pkg/storageprovider"
+)
+
+// Drain is a device the storage system is moving data off. The cloud
+// device is deleted once the drain is done.
+type Drain struct {
+	InstanceID string
+	DeviceID   string
+
+	// Started is when the removal of the device was requested
+	Started time.Time
+
+	// Progress of the drain as a percentage number
+	Progress int
+}
+
+// startDrain keeps track of the device until the storage system has
+// finished removing it
+func (m *Manager) startDrain(
+	state *classState,
+	node *storageprovider.StorageNode,
+	device *storageprovider.Device,
+	status *storageprovider.RemoveStatus,
+) {
+	if state.drains == nil {
+		state.drains = make(map[string]*Drain)
+	}
+	state.drains[device.Metadata.ID] = &Drain{
+		InstanceID: node.Metadata.ID,
+		DeviceID:   device.Metadata.ID,
+		Started:    m.now(),
+		Progress:   status.Progress,
+	}
+	dlog.Infof("Draining device %s from node %s", device.Metadata.ID, node.Metadata.ID)
+}
+
+// checkDrains deletes the cloud devices which the storage system has
+// finished removing, and aborts the drains which take longer than the
+// timeout of the class
+func (m *Manager) checkDrains(class *Class, state *classState) {
+	if len(state.drains) == 0 {
+		return
+	}
+	t, err := m.storage.GetTopology()
+	if err != nil {
+		dlog.Errorf("Failed to get topology: %v", err)
+		return
+	}
+
+	for id, drain := range state.drains {
+		node := findNode(t, drain.InstanceID)
+		if node == nil {
+			node = &storageprovider.StorageNode{
+				Metadata: storageprovider.InstanceMetadata{
+					ID: drain.InstanceID,
+				},
+			}
+		}
+		device := findDevice(node, id)
+		if device == nil {
+			device = &storageprovider.Device{
+				Metadata: storageprovider.DeviceMetadata{
+					ID: id,
+				},
+			}
+		}
+
+		status, err := m.storage.DeviceRemoveStatus(node, device)
+		if err != nil {
+			dlog.Errorf("Failed to get removal status of device %s: %v", id, err)
+			continue
+		}
+		switch status.State {
+		case storageprovider.RemoveDone:
+			if err := m.cloud.DeviceDelete(drain.InstanceID, id); err != nil {
+				dlog.Errorf("Failed to delete drained device %s: %v", id, err)
+				continue
+			}
+			dlog.Infof("Deleted drained device %s from node %s", id, drain.InstanceID)
+			delete(state.drains, id)
+
+		case storageprovider.RemoveFailed:
+			dlog.Errorf("Failed to drain device %s from node %s: %s",
+				id,
+				drain.InstanceID,
+				status.Message)
+			delete(state.drains, id)
+
+		default:
+			drain.Progress = status.Progress
+			if class.DrainTimeout <= 0 || m.now().Sub(drain.Started) < class.DrainTimeout {
+				continue
+			}
+			if err := m.storage.DeviceRemoveAbort(node, device); err != nil {
+				dlog.Errorf("Failed to abort drain of device %s: %v", id, err)
+				continue
+			}
+			dlog.Errorf("Aborted drain of device %s from node %s after %v",
+				id,
+				drain.InstanceID,
+				class.DrainTimeout)
+			delete(state.drains, id)
+		}
+	}
+}
+
+// drainList returns the drains of the class, oldest first
+func (s *classState) drainList() []Drain {
+	drains := make([]Drain, 0, len(s.drains))
+	for _, drain := range s.drains {
+		drains = append(drains, *drain)
+	}
+	sort.Slice(drains, func(i, j int) bool {
+		if !drains[i].Started.Equal(drains[j].Started) {
+			return drains[i].Started.Before(drains[j].Started)
+		}
+		return drains[i].DeviceID < drains[j].DeviceID
+	})
+	return drains
+}
@@ -0,0 +1,101 @@
+/*
+Package inframanager provides an interface to the infrastrcture manager
+Copyright 2018 Portworx
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package inframanager
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/libopenstorage/rico/pkg/cloudprovider"
+	cloudfake "github.com/libopenstorage/rico/pkg/cloudprovider/fake"
+	"github.com/libopenstorage/rico/pkg/storageprovider"
+	"github.com/libopenstorage/rico/pkg/storageprovider/fake"
+)
+
+func TestDrainBeforeDelete(t *testing.T) {
+	cloud := cloudfake.New()
+	nodes := newTestNodes("i-1")
+	for i := 0; i < 3; i++ {
+		d, err := cloud.DeviceCreate("i-1", &cloudprovider.DeviceSpecs{Size: 8})
+		assert.NoError(t, err)
+		nodes[0].Devices = append(nodes[0].Devices, &storageprovider.Device{
+			Size:        8,
+			Utilization: i,
+			Metadata:    storageprovider.DeviceMetadata{ID: d.ID},
+		})
+	}
+	storage := fake.New(&storageprovider.Topology{
+		Cluster: storageprovider.StorageCluster{
+			StorageNodes: nodes,
+		},
+	})
+	storage.AsyncRemove = true
+	storage.CurrentUtilization = 10
+	class := Class{
+		Name:          "gp2",
+		WatermarkHigh: 75,
+		WatermarkLow:  25,
+		DiskSets:      1,
+		DiskSizeGb:    8,
+		DrainTimeout:  time.Hour,
+	}
+	im := NewManager(&Config{Classes: []Class{class}}, cloud, storage)
+	now := time.Now()
+	im.now = func() time.Time { return now }
+
+	// The cloud device is kept while the storage system drains it
+	assert.NoError(t, im.do(&class))
+	assert.Equal(t, 3, cloud.NumDevices())
+	assert.Equal(t, 3, storage.NumDevices())
+	status, err := im.Status("gp2")
+	assert.NoError(t, err)
+	assert.Len(t, status.Draining, 1)
+	assert.Equal(t, "vol-1", status.Draining[0].DeviceID)
+	assert.Equal(t, now, status.Draining[0].Started)
+
+	// Nothing else is removed until the drain finishes
+	storage.Removals["vol-1"].Progress = 50
+	assert.NoError(t, im.do(&class))
+	status, err = im.Status("gp2")
+	assert.NoError(t, err)
+	assert.Len(t, status.Draining, 1)
+	assert.Equal(t, 50, status.Draining[0].Progress)
+
+	// The next device is drained once the first one is deleted
+	storage.FinishRemove("vol-1")
+	assert.NoError(t, im.do(&class))
+	assert.Equal(t, 2, cloud.NumDevices())
+	assert.Equal(t, 2, storage.NumDevices())
+	status, err = im.Status("gp2")
+	assert.NoError(t, err)
+	assert.Len(t, status.Draining, 1)
+	assert.Equal(t, "vol-2", status.Draining[0].DeviceID)
+
+	// Drains which take too long are aborted
+	assert.Contains(t, storage.Removals, "vol-2")
+	now = now.Add(2 * time.Hour)
+	storage.CurrentUtilization = 50
+	assert.NoError(t, im.do(&class))
+	assert.NotContains(t, storage.Removals, "vol-2")
+	assert.Equal(t, 2, cloud.NumDevices())
+	assert.Equal(t, 2, storage.NumDevices())
+	status, err = im.Status("gp2")
+	assert.NoError(t, err)
+	assert.Len(t, status.Draining, 0)
+}
@@ -0,0 +1,238 @@
+/*
+Package inframanager provides an interface to the infrastrcture manager
+Copyright 2018 Portworx
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package inframanager
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"go.pedge.io/dlog"
+
+	"github.com/libopenstorage/rico/pkg/cloudprovider"
+	"github.com/libopenstorage/rico/pkg/storageprovider"
+)
+
+const (
+	// Maximum number of dry run calls kept by the manager
+	maxDryRunCalls = 1000
+)
+
+// DryRunCall is a call to a provider which the manager would have made
+// if it was not running in dry run mode
+type DryRunCall struct {
+	// Time of the call
+	Time time.Time
+
+	// Method of the provider, for example DeviceCreate
+	Method string
+
+	// InstanceID of the node
+	InstanceID string
+
+	// DeviceID of the cloud device. Devices which would have been
+	// created have an ID starting with "dryrun-".
+	DeviceID string
+
+	// Size of the device in GiB
+	Size uint64
+
+	// Parameters of the device
+	Parameters map[string]string
+}
+
+// dryRunRecorder keeps the calls which would have been made
+type dryRunRecorder struct {
+	lock   sync.Mutex
+	calls  []DryRunCall
+	nextID int
+}
+
+func (r *dryRunRecorder) record(call DryRunCall) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	call.Time = time.Now()
+	dlog.Infof("Dry run: %s instance=%s device=%s size=%d",
+		call.Method,
+		call.InstanceID,
+		call.DeviceID,
+		call.Size)
+
+	r.calls = append(r.calls, call)
+	if len(r.calls) > maxDryRunCalls {
+		r.calls = r.calls[len(r.calls)-maxDryRunCalls:]
+	}
+}
+
+func (r *dryRunRecorder) newID() string {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.nextID++
+	return fmt.Sprintf("dryrun-%d", r.nextID)
+}
+
+// dryRunCloud records the calls which would change the cloud
+type dryRunCloud struct {
+	cloud    cloudprovider.Interface
+	recorder *dryRunRecorder
+}
+
+func (d *dryRunCloud) DeviceCreate(
+	instanceID string,
+	device *cloudprovider.DeviceSpecs,
+) (*cloudprovider.Device, error) {
+	id := d.recorder.newID()
+	d.recorder.record(DryRunCall{
+		Method:     "DeviceCreate",
+		InstanceID: instanceID,
+		DeviceID:   id,
+		Size:       device.Size,
+		Parameters: device.Parameters,
+	})
+	return &cloudprovider.Device{
+		ID:      id,
+		Size:    device.Size,
+		Created: time.Now(),
+	}, nil
+}
+
+func (d *dryRunCloud) DeviceDelete(instanceID string, deviceID string) error {
+	d.recorder.record(DryRunCall{
+		Method:     "DeviceDelete",
+		InstanceID: instanceID,
+		DeviceID:   deviceID,
+	})
+	return nil
+}
+
+func (d *dryRunCloud) DeviceResize(instanceID string, deviceID string, size uint64) error {
+	d.recorder.record(DryRunCall{
+		Method:     "DeviceResize",
+		InstanceID: instanceID,
+		DeviceID:   deviceID,
+		Size:       size,
+	})
+	return nil
+}
+
+func (d *dryRunCloud) DeviceList() ([]*cloudprovider.Device, error) {
+	return d.cloud.DeviceList()
+}
+
+func (d *dryRunCloud) AttachmentCapacity(instanceID string) (int, error) {
+	return d.cloud.AttachmentCapacity(instanceID)
+}
+
+// dryRunStorage records the calls which would change the storage system
+type dryRunStorage struct {
+	storage  storageprovider.Interface
+	recorder *dryRunRecorder
+}
+
+func (d *dryRunStorage) GetTopology() (*storageprovider.Topology, error) {
+	return d.storage.GetTopology()
+}
+
+func (d *dryRunStorage) Utilization() (int, error) {
+	return d.storage.Utilization()
+}
+
+func (d *dryRunStorage) ClassUtilization(class string) (int, error) {
+	return d.storage.ClassUtilization(class)
+}
+
+func (d *dryRunStorage) DeviceAdd(
+	node *storageprovider.StorageNode,
+	device *storageprovider.Device,
+) error {
+	d.recorder.record(DryRunCall{
+		Method:     "DeviceAdd",
+		InstanceID: node.Metadata.ID,
+		DeviceID:   device.Metadata.ID,
+		Size:       device.Size,
+	})
+	return nil
+}
+
+func (d *dryRunStorage) DeviceRemove(
+	node *storageprovider.StorageNode,
+	device *storageprovider.Device,
+) error {
+	d.recorder.record(DryRunCall{
+		Method:     "DeviceRemove",
+		InstanceID: node.Metadata.ID,
+		DeviceID:   device.Metadata.ID,
+		Size:       device.Size,
+	})
+	return nil
+}
+
+func (d *dryRunStorage) DeviceRemoveStatus(
+	node *storageprovider.StorageNode,
+	device *storageprovider.Device,
+) (*storageprovider.RemoveStatus, error) {
+	return &storageprovider.RemoveStatus{
+		State:    storageprovider.RemoveDone,
+		Progress: 100,
+	}, nil
+}
+
+func (d *dryRunStorage) DeviceRemoveAbort(
+	node *storageprovider.StorageNode,
+	device *storageprovider.Device,
+) error {
+	d.recorder.record(DryRunCall{
+		Method:     "DeviceRemoveAbort",
+		InstanceID: node.Metadata.ID,
+		DeviceID:   device.Metadata.ID,
+		Size:       device.Size,
+	})
+	return nil
+}
+
+func (d *dryRunStorage) DeviceExpanded(
+	node *storageprovider.StorageNode,
+	device *storageprovider.Device,
+) error {
+	d.recorder.record(DryRunCall{
+		Method:     "DeviceExpanded",
+		InstanceID: node.Metadata.ID,
+		DeviceID:   device.Metadata.ID,
+		Size:       device.Size,
+	})
+	return nil
+}
+
+func (d *dryRunStorage) Events() (<-chan *storageprovider.Event, error) {
+	return d.storage.Events()
+}
+
+// DryRunCalls returns the provider calls the manager would have made,
+// oldest first. It is empty unless Config.DryRun is set.
+func (m *Manager) DryRunCalls() []DryRunCall {
+	if m.dryRun == nil {
+		return nil
+	}
+
+	m.dryRun.lock.Lock()
+	defer m.dryRun.lock.Unlock()
+	calls := make([]DryRunCall, len(m.dryRun.calls))
+	copy(calls, m.dryRun.calls)
+	return calls
+}
@@ -0,0 +1,81 @@
+/*
+Package inframanager provides an interface to the infrastrcture manager
+Copyright 2018 Portworx
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package inframanager
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	cloudfake "github.com/libopenstorage/rico/pkg/cloudprovider/fake"
+	"github.com/libopenstorage/rico/pkg/storageprovider"
+	"github.com/libopenstorage/rico/pkg/storageprovider/fake"
+)
+
+func TestDryRun(t *testing.T) {
+	nodes := newTestNodes("i-1", "i-2")
+	nodes[0].Devices = []*storageprovider.Device{
+		{Size: 8, Metadata: storageprovider.DeviceMetadata{ID: "vol-1"}},
+	}
+	storage := fake.New(&storageprovider.Topology{
+		Cluster: storageprovider.StorageCluster{
+			StorageNodes: nodes,
+		},
+	})
+	cloud := cloudfake.New()
+	class := Class{
+		Name:          "gp2",
+		Parameters:    map[string]string{"type": "gp2"},
+		WatermarkHigh: 75,
+		WatermarkLow:  25,
+		DiskSets:      2,
+		DiskSizeGb:    16,
+	}
+	im := NewManager(&Config{
+		Classes: []Class{class},
+		DryRun:  true,
+	}, cloud, storage)
+
+	storage.CurrentUtilization = 80
+	assert.NoError(t, im.do(&class))
+	storage.CurrentUtilization = 10
+	assert.NoError(t, im.do(&class))
+
+	// Nothing changed
+	assert.Equal(t, 1, storage.NumDevices())
+	assert.Equal(t, 0, cloud.NumDevices())
+
+	calls := im.DryRunCalls()
+	assert.Len(t, calls, 6)
+	methods := make([]string, len(calls))
+	for i, call := range calls {
+		methods[i] = call.Method
+	}
+	assert.Equal(t, []string{
+		"DeviceCreate", "DeviceAdd",
+		"DeviceCreate", "DeviceAdd",
+		"DeviceRemove", "DeviceDelete",
+	}, methods)
+	assert.Equal(t, "i-2", calls[0].InstanceID)
+	assert.Equal(t, uint64(16), calls[0].Size)
+	assert.Equal(t, class.Parameters, calls[0].Parameters)
+	assert.Equal(t, calls[0].DeviceID, calls[1].DeviceID)
+	assert.Equal(t, "vol-1", calls[5].DeviceID)
+	assert.Equal(t, "i-1", calls[5].InstanceID)
+
+	assert.Nil(t, NewManager(&Config{}, cloud, storage).DryRunCalls())
+}
@@ -0,0 +1,83 @@
+/*
+Package inframanager provides an interface to the infrastrcture manager
+Copyright 2018 Portworx
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package inframanager
+
+import (
+	"go.pedge.io/dlog"
+
+	"github.com/libopenstorage/rico/pkg/storageprovider"
+)
+
+// subscribe starts reconciling the classes when the storage system
+// reports relevant changes. Providers which do not send events are only
+// checked on the interval of each class.
+func (m *Manager) subscribe(quit <-chan struct{}, triggers classTriggers) error {
+	events, err := m.storage.Events()
+	if err == storageprovider.ErrNotSupported {
+		dlog.Infof("Storage provider does not send events")
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	go func() {
+		for {
+			select {
+			case <-quit:
+				return
+			case event, ok := <-events:
+				if !ok {
+					dlog.Infof("Storage provider stopped sending events")
+					return
+				}
+				triggers.handle(event)
+			}
+		}
+	}()
+	return nil
+}
+
+// classTriggers wake up the eventloop of each class
+type classTriggers map[string]chan struct{}
+
+// handle triggers a reconcile of the classes affected by the event
+func (t classTriggers) handle(event *storageprovider.Event) {
+	switch event.Type {
+	case storageprovider.EventNodeAdded,
+		storageprovider.EventNodeRemoved,
+		storageprovider.EventDeviceFailed,
+		storageprovider.EventDeviceDrained,
+		storageprovider.EventRebalanceFinished:
+		t.trigger("")
+	case storageprovider.EventUtilizationChanged:
+		t.trigger(event.Class)
+	}
+}
+
+// trigger wakes up the eventloop of the class, or of every class if the
+// name is empty. A pending trigger is not repeated.
+func (t classTriggers) trigger(class string) {
+	for name, trigger := range t {
+		if len(class) != 0 && name != class {
+			continue
+		}
+		select {
+		case trigger <- struct{}{}:
+		default:
+		}
+	}
+}
@@ -0,0 +1,89 @@
+/*
+Package inframanager provides an interface to the infrastrcture manager
+Copyright 2018 Portworx
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package inframanager
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	cloudfake "github.com/libopenstorage/rico/pkg/cloudprovider/fake"
+	"github.com/libopenstorage/rico/pkg/storageprovider"
+	"github.com/libopenstorage/rico/pkg/storageprovider/fake"
+)
+
+func TestEventTriggers(t *testing.T) {
+	triggers := classTriggers{
+		"ssd": make(chan struct{}, 1),
+		"hdd": make(chan struct{}, 1),
+	}
+
+	// Only the class whose utilization changed is triggered
+	triggers.handle(&storageprovider.Event{
+		Type:  storageprovider.EventUtilizationChanged,
+		Class: "ssd",
+	})
+	assert.Len(t, triggers["ssd"], 1)
+	assert.Len(t, triggers["hdd"], 0)
+
+	// Pending triggers are not repeated
+	triggers.handle(&storageprovider.Event{
+		Type: storageprovider.EventNodeAdded,
+	})
+	assert.Len(t, triggers["ssd"], 1)
+	assert.Len(t, triggers["hdd"], 1)
+	<-triggers["ssd"]
+	<-triggers["hdd"]
+
+	// Devices added by the manager do not trigger a reconcile
+	triggers.handle(&storageprovider.Event{
+		Type: storageprovider.EventDeviceAdded,
+	})
+	assert.Len(t, triggers["ssd"], 0)
+	assert.Len(t, triggers["hdd"], 0)
+}
+
+func TestEventReconcile(t *testing.T) {
+	storage := fake.New(&storageprovider.Topology{
+		Cluster: storageprovider.StorageCluster{
+			StorageNodes: newTestNodes("i-1"),
+		},
+	})
+	storage.CurrentUtilization = 80
+	cloud := cloudfake.New()
+	class := Class{
+		Name:          "gp2",
+		WatermarkHigh: 75,
+		DiskSets:      1,
+		DiskSizeGb:    8,
+		Interval:      time.Hour,
+	}
+	im := NewManager(&Config{Classes: []Class{class}}, cloud, storage)
+	assert.NoError(t, im.Start())
+	defer im.Stop()
+
+	storage.Publish(&storageprovider.Event{
+		Type:        storageprovider.EventUtilizationChanged,
+		Utilization: 80,
+	})
+	deadline := time.Now().Add(5 * time.Second)
+	for cloud.NumDevices() == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Equal(t, 1, cloud.NumDevices())
+}
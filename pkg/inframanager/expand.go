@@ -0,0 +1,178 @@
+/*
+Package inframanager provides an interface to the infrastrcture manager
+Copyright 2018 Portworx
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package inframanager
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/libopenstorage/rico/pkg/storageprovider"
+)
+
+// Default minimum time between resizes of a device
+const defaultExpandInterval = 6 * time.Hour
+
+// validateExpand checks the device expansion settings of the class
+func (c *Class) validateExpand() error {
+	if !c.ExpandDevices {
+		return nil
+	}
+	if c.MaxDeviceSizeGb == 0 {
+		return fmt.Errorf("Class %s expands devices but has no MaxDeviceSizeGb", c.Name)
+	}
+	if c.MaxDeviceSizeGb < c.DiskSizeGb {
+		return fmt.Errorf("MaxDeviceSizeGb of class %s is below DiskSizeGb", c.Name)
+	}
+	if c.ExpandInterval < 0 {
+		return fmt.Errorf("ExpandInterval of class %s must not be negative", c.Name)
+	}
+	return nil
+}
+
+// expandInterval returns the minimum time between resizes of a device
+func (c *Class) expandInterval() time.Duration {
+	if c.ExpandInterval == 0 {
+		return defaultExpandInterval
+	}
+	return c.ExpandInterval
+}
+
+// expandStep returns the GiB added to a device each time it is expanded
+func (c *Class) expandStep() uint64 {
+	if c.ExpandStepGb == 0 {
+		return c.DiskSizeGb
+	}
+	return c.ExpandStepGb
+}
+
+// planExpand adds steps to the plan which grow the devices of the class
+// by up to size GiB, smallest device first. Each device is resized at
+// most once, and devices in skip are not resized. It returns the GiB
+// added.
+func planExpand(
+	plan *Plan,
+	t *storageprovider.Topology,
+	class *Class,
+	size uint64,
+	skip map[string]bool,
+	reason string,
+) uint64 {
+	// Work out the final size of each device
+	var grown uint64
+	previous := make(map[deviceSlot]uint64)
+	order := make([]deviceSlot, 0)
+	for grown < size {
+		node, index := smallestDevice(t, class, skip)
+		if node == nil {
+			break
+		}
+		device := node.Devices[index]
+		step := class.expandStep()
+		if device.Size+step > class.MaxDeviceSizeGb {
+			step = class.MaxDeviceSizeGb - device.Size
+		}
+		if class.MaxCapacityGb > 0 &&
+			classCapacity(t, class)+step > class.MaxCapacityGb {
+			break
+		}
+
+		slot := deviceSlot{node: node, index: index}
+		if _, ok := previous[slot]; !ok {
+			previous[slot] = device.Size
+			order = append(order, slot)
+		}
+
+		// Account for the new size without changing the device of
+		// the storage provider
+		expanded := *device
+		expanded.Size += step
+		node.Devices[index] = &expanded
+		grown += step
+	}
+
+	for _, slot := range order {
+		device := slot.node.Devices[slot.index]
+		for _, action := range []StepAction{StepResize, StepExpand} {
+			plan.Steps = append(plan.Steps, &Step{
+				Action:       action,
+				InstanceID:   slot.node.Metadata.ID,
+				DeviceID:     device.Metadata.ID,
+				Size:         device.Size,
+				PreviousSize: previous[slot],
+				Reason:       reason,
+			})
+		}
+	}
+	return grown
+}
+
+// deviceSlot is the position of a device in the topology
+type deviceSlot struct {
+	node  *storageprovider.StorageNode
+	index int
+}
+
+// smallestDevice returns the node and index of the smallest device of the
+// class which can still grow and is not in skip
+func smallestDevice(
+	t *storageprovider.Topology,
+	class *Class,
+	skip map[string]bool,
+) (*storageprovider.StorageNode, int) {
+	var (
+		smallest *storageprovider.StorageNode
+		index    int
+	)
+	for _, node := range t.Cluster.StorageNodes {
+		for i, device := range node.Devices {
+			if !deviceInClass(device, class) ||
+				len(device.Metadata.ID) == 0 ||
+				skip[device.Metadata.ID] ||
+				device.Size >= class.MaxDeviceSizeGb {
+				continue
+			}
+			if smallest == nil || device.Size < smallest.Devices[index].Size {
+				smallest = node
+				index = i
+			}
+		}
+	}
+	return smallest, index
+}
+
+// setResized records that the device was just resized
+func (m *Manager) setResized(deviceID string) {
+	m.resizedLock.Lock()
+	defer m.resizedLock.Unlock()
+
+	m.resized[deviceID] = m.now()
+}
+
+// recentlyResized returns the IDs of the devices resized within the
+// expand interval of the class, which cannot be resized again yet
+func (m *Manager) recentlyResized(class *Class) map[string]bool {
+	m.resizedLock.Lock()
+	defer m.resizedLock.Unlock()
+
+	devices := make(map[string]bool)
+	for id, resized := range m.resized {
+		if m.now().Sub(resized) < class.expandInterval() {
+			devices[id] = true
+		}
+	}
+	return devices
+}
@@ -0,0 +1,127 @@
+/*
+Package inframanager provides an interface to the infrastrcture manager
+Copyright 2018 Portworx
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package inframanager
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/libopenstorage/rico/pkg/cloudprovider"
+	cloudfake "github.com/libopenstorage/rico/pkg/cloudprovider/fake"
+	"github.com/libopenstorage/rico/pkg/storageprovider"
+	"github.com/libopenstorage/rico/pkg/storageprovider/fake"
+)
+
+func TestExpandDevices(t *testing.T) {
+	cloud := cloudfake.New()
+	d, err := cloud.DeviceCreate("i-1", &cloudprovider.DeviceSpecs{Size: 8})
+	assert.NoError(t, err)
+	nodes := newTestNodes("i-1")
+	nodes[0].Devices = []*storageprovider.Device{
+		{Size: 8, Metadata: storageprovider.DeviceMetadata{ID: d.ID}},
+	}
+	storage := fake.New(&storageprovider.Topology{
+		Cluster: storageprovider.StorageCluster{
+			StorageNodes: nodes,
+		},
+	})
+	storage.CurrentUtilization = 80
+	class := Class{
+		Name:            "gp2",
+		WatermarkHigh:   75,
+		DiskSets:        1,
+		DiskSizeGb:      8,
+		ExpandDevices:   true,
+		MaxDeviceSizeGb: 20,
+	}
+	assert.NoError(t, class.validate())
+	im := NewManager(&Config{Classes: []Class{class}}, cloud, storage)
+	now := time.Now()
+	im.now = func() time.Time { return now }
+
+	// The device grows instead of adding a new one
+	plan, err := im.Plan("gp2")
+	assert.NoError(t, err)
+	assert.Len(t, plan.Steps, 2)
+	assert.Equal(t, StepResize, plan.Steps[0].Action)
+	assert.Equal(t, StepExpand, plan.Steps[1].Action)
+	assert.Equal(t, uint64(16), plan.Steps[0].Size)
+	assert.Equal(t, uint64(8), plan.Steps[0].PreviousSize)
+	assert.Equal(t, uint64(8), planSize(plan))
+	assert.NoError(t, im.do(&class))
+	assert.Equal(t, 1, storage.NumDevices())
+	assert.Equal(t, uint64(16), nodes[0].Devices[0].Size)
+	assert.Equal(t, uint64(16), d.Size)
+
+	// A device is added when the device was resized too recently
+	assert.NoError(t, im.do(&class))
+	assert.Equal(t, 2, storage.NumDevices())
+	assert.Equal(t, uint64(16), nodes[0].Devices[0].Size)
+	assert.Equal(t, uint64(8), nodes[0].Devices[1].Size)
+
+	// The smallest device which can be resized grows first
+	assert.NoError(t, im.do(&class))
+	assert.Equal(t, 2, storage.NumDevices())
+	assert.Equal(t, uint64(16), nodes[0].Devices[0].Size)
+	assert.Equal(t, uint64(16), nodes[0].Devices[1].Size)
+
+	// Devices grow again after the expand interval
+	now = now.Add(6 * time.Hour)
+	assert.NoError(t, im.do(&class))
+	assert.Equal(t, 2, storage.NumDevices())
+	assert.Equal(t, uint64(20), nodes[0].Devices[0].Size)
+	assert.Equal(t, uint64(20), nodes[0].Devices[1].Size)
+
+	class.MaxDeviceSizeGb = 4
+	assert.Error(t, class.validate())
+}
+
+func TestExpandDeviceOnce(t *testing.T) {
+	nodes := newTestNodes("i-1")
+	nodes[0].Devices = []*storageprovider.Device{
+		{Size: 8, Metadata: storageprovider.DeviceMetadata{ID: "vol-1"}},
+	}
+	storage := fake.New(&storageprovider.Topology{
+		Cluster: storageprovider.StorageCluster{
+			StorageNodes: nodes,
+		},
+	})
+	storage.CurrentUtilization = 80
+	class := Class{
+		Name:            "gp2",
+		WatermarkHigh:   75,
+		DiskSets:        1,
+		DiskSizeGb:      8,
+		ScaleUpSteps:    []ScalingStep{{Utilization: 75, Count: 3}},
+		ExpandDevices:   true,
+		MaxDeviceSizeGb: 64,
+	}
+	im := NewManager(&Config{Classes: []Class{class}}, cloudfake.New(), storage)
+
+	// Growing by three steps is a single resize
+	plan, err := im.Plan("gp2")
+	assert.NoError(t, err)
+	assert.Len(t, plan.Steps, 2)
+	assert.Equal(t, StepResize, plan.Steps[0].Action)
+	assert.Equal(t, uint64(32), plan.Steps[0].Size)
+	assert.Equal(t, uint64(8), plan.Steps[0].PreviousSize)
+	assert.Equal(t, uint64(32), plan.Steps[1].Size)
+	assert.Equal(t, uint64(24), planSize(plan))
+	assert.Equal(t, uint64(8), nodes[0].Devices[0].Size)
+}
@@ -0,0 +1,237 @@
+/*
+Package inframanager provides an interface to the infrastrcture manager
+Copyright 2018 Portworx
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package inframanager
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/libopenstorage/rico/pkg/storageprovider"
+)
+
+// FilterPlugin removes the nodes which cannot receive new devices of a
+// class
+type FilterPlugin interface {
+	// Filter returns nil if the node may receive a new device of the
+	// class, or an error describing why it may not
+	Filter(
+		t *storageprovider.Topology,
+		class *Class,
+		node *storageprovider.StorageNode,
+	) error
+}
+
+// FilterFunc is an adapter to use a function as a FilterPlugin
+type FilterFunc func(
+	t *storageprovider.Topology,
+	class *Class,
+	node *storageprovider.StorageNode,
+) error
+
+// Filter calls f(t, class, node)
+func (f FilterFunc) Filter(
+	t *storageprovider.Topology,
+	class *Class,
+	node *storageprovider.StorageNode,
+) error {
+	return f(t, class, node)
+}
+
+const (
+	// FilterClass removes the nodes which do not support the class
+	FilterClass = "class"
+
+	// FilterAffinity removes the nodes which do not satisfy the node
+	// selector and required affinity rules of the class
+	FilterAffinity = "affinity"
+)
+
+var (
+	filtersLock sync.Mutex
+	filters     = map[string]FilterPlugin{
+		FilterClass: FilterFunc(func(
+			t *storageprovider.Topology,
+			class *Class,
+			node *storageprovider.StorageNode,
+		) error {
+			if !nodeSupportsClass(node, class) {
+				return fmt.Errorf("Node %s does not support class %s",
+					node.Metadata.ID,
+					class.Name)
+			}
+			return nil
+		}),
+		FilterAffinity: FilterFunc(func(
+			t *storageprovider.Topology,
+			class *Class,
+			node *storageprovider.StorageNode,
+		) error {
+			if !class.NodeAllowed(node) {
+				return fmt.Errorf("Node %s does not match the selector and "+
+					"affinity of class %s",
+					node.Metadata.ID,
+					class.Name)
+			}
+			return nil
+		}),
+	}
+
+	// defaultFilters are applied to every class
+	defaultFilters = []string{FilterClass, FilterAffinity}
+)
+
+// RegisterFilter registers a filter plugin which can then be used by
+// adding its name to Class.Scheduler.Filters
+func RegisterFilter(name string, f FilterPlugin) error {
+	filtersLock.Lock()
+	defer filtersLock.Unlock()
+
+	if len(name) == 0 {
+		return fmt.Errorf("Filter name must not be empty")
+	}
+	if f == nil {
+		return fmt.Errorf("Filter %s is nil", name)
+	}
+	if _, ok := filters[name]; ok {
+		return fmt.Errorf("Filter %s already registered", name)
+	}
+	filters[name] = f
+	return nil
+}
+
+// getFilters returns the filter plugins with the given names
+func getFilters(names []string) ([]FilterPlugin, error) {
+	filtersLock.Lock()
+	defer filtersLock.Unlock()
+
+	plugins := make([]FilterPlugin, len(names))
+	for i, name := range names {
+		f, ok := filters[name]
+		if !ok {
+			return nil, fmt.Errorf("Unknown filter %s", name)
+		}
+		plugins[i] = f
+	}
+	return plugins, nil
+}
+
+// filterNodes returns the nodes which pass all the filters. The reason
+// each node was removed is returned in reasons.
+func filterNodes(
+	t *storageprovider.Topology,
+	class *Class,
+	plugins []FilterPlugin,
+) (nodes []*storageprovider.StorageNode, reasons map[*storageprovider.StorageNode]error) {
+	reasons = make(map[*storageprovider.StorageNode]error)
+	nodes = make([]*storageprovider.StorageNode, 0, len(t.Cluster.StorageNodes))
+	for _, node := range t.Cluster.StorageNodes {
+		var reason error
+		for _, plugin := range plugins {
+			if reason = plugin.Filter(t, class, node); reason != nil {
+				break
+			}
+		}
+		if reason != nil {
+			reasons[node] = reason
+		} else {
+			nodes = append(nodes, node)
+		}
+	}
+	return nodes, reasons
+}
+
+// nodeSupportsClass returns true if the node can use devices of the class.
+// Nodes which do not list any classes support all of them.
+func nodeSupportsClass(node *storageprovider.StorageNode, class *Class) bool {
+	if len(node.Classes) == 0 {
+		return true
+	}
+	for _, name := range node.Classes {
+		if name == class.Name {
+			return true
+		}
+	}
+	return false
+}
+
+// eligibleTopology returns a copy of the topology which only contains the
+// nodes which pass the default filters
+func eligibleTopology(
+	t *storageprovider.Topology,
+	class *Class,
+) (*storageprovider.Topology, error) {
+	plugins, err := getFilters(defaultFilters)
+	if err != nil {
+		return nil, err
+	}
+
+	nodes, reasons := filterNodes(t, class, plugins)
+	if len(nodes) == 0 {
+		if len(t.Cluster.StorageNodes) == 0 {
+			return nil, fmt.Errorf("Cluster has no storage nodes")
+		}
+		return nil, fmt.Errorf("No storage nodes are eligible for class %s: %v",
+			class.Name,
+			reasons[t.Cluster.StorageNodes[0]])
+	}
+
+	return &storageprovider.Topology{
+		Cluster: storageprovider.StorageCluster{
+			StorageNodes: nodes,
+			Private:      t.Cluster.Private,
+		},
+	}, nil
+}
+
+// attachableTopology returns a copy of the topology without the nodes
+// which cannot attach another device
+func attachableTopology(
+	t *storageprovider.Topology,
+	capacity map[*storageprovider.StorageNode]int,
+) *storageprovider.Topology {
+	nodes := make([]*storageprovider.StorageNode, 0, len(t.Cluster.StorageNodes))
+	for _, node := range t.Cluster.StorageNodes {
+		if c, ok := capacity[node]; !ok || c != 0 {
+			nodes = append(nodes, node)
+		}
+	}
+
+	return &storageprovider.Topology{
+		Cluster: storageprovider.StorageCluster{
+			StorageNodes: nodes,
+			Private:      t.Cluster.Private,
+		},
+	}
+}
+
+// checkCapacity returns an error if a node was picked for more devices
+// than it can attach
+func checkCapacity(
+	nodes []*storageprovider.StorageNode,
+	capacity map[*storageprovider.StorageNode]int,
+) error {
+	picked := make(map[*storageprovider.StorageNode]int)
+	for _, node := range nodes {
+		picked[node]++
+		if c, ok := capacity[node]; ok && c >= 0 && picked[node] > c {
+			return fmt.Errorf("Node %s can only attach %d more devices",
+				node.Metadata.ID,
+				c)
+		}
+	}
+	return nil
+}
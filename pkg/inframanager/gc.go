@@ -0,0 +1,165 @@
+/*
+Package inframanager provides an interface to the infrastrcture manager
+Copyright 2018 Portworx
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package inframanager
+
+import (
+	"fmt"
+	"time"
+
+	"go.pedge.io/dlog"
+)
+
+// Default time a device stays orphaned before it is deleted
+const defaultGracePeriod = time.Hour
+
+// GCConfig configures the garbage collector which finds the cloud
+// devices created by the manager but unknown to the storage system
+type GCConfig struct {
+	// Interval between sweeps. The garbage collector is disabled if
+	// not set.
+	Interval time.Duration
+
+	// GracePeriod is how long a device stays orphaned before it is
+	// deleted. Defaults to one hour.
+	GracePeriod time.Duration
+
+	// DryRun reports orphans without deleting them
+	DryRun bool
+}
+
+// gracePeriod returns how long a device stays orphaned before it is
+// deleted
+func (c *GCConfig) gracePeriod() time.Duration {
+	if c.GracePeriod <= 0 {
+		return defaultGracePeriod
+	}
+	return c.GracePeriod
+}
+
+// gcloop runs the garbage collector until the manager stops
+func (m *Manager) gcloop(quit <-chan struct{}) {
+	ticker := time.NewTicker(m.config.GC.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-quit:
+			return
+		case <-ticker.C:
+			if err := m.collectGarbage(); err != nil {
+				dlog.Errorf("Garbage collection failed: %v", err)
+			}
+		}
+	}
+}
+
+// collectGarbage compares the cloud devices with the devices of the
+// storage system. Unknown devices are reported as orphans and deleted
+// once they have been orphaned for longer than the grace period.
+func (m *Manager) collectGarbage() error {
+	devices, err := m.cloud.DeviceList()
+	if err != nil {
+		return err
+	}
+
+	// Devices still being created are known. They are listed before the
+	// topology so that a device added in between is in one of them.
+	known := m.creatingDevices()
+	t, err := m.storage.GetTopology()
+	if err != nil {
+		return fmt.Errorf("Failed to get topology: %v", err)
+	}
+
+	// Devices in use or being drained
+	for _, node := range t.Cluster.StorageNodes {
+		for _, device := range node.Devices {
+			known[device.Metadata.ID] = true
+		}
+	}
+	for _, state := range m.classStates() {
+		state.lock.Lock()
+		for id := range state.drains {
+			known[id] = true
+		}
+		state.lock.Unlock()
+	}
+
+	listed := make(map[string]bool)
+	for _, device := range devices {
+		listed[device.ID] = true
+		if known[device.ID] {
+			continue
+		}
+
+		orphan := m.orphan(device.ID)
+		if orphan == nil {
+			m.addOrphan(device.InstanceID, device.ID,
+				"Device is not used by the storage system",
+				false)
+			continue
+		}
+		if orphan.Adopt || m.now().Sub(orphan.Detected) < m.config.GC.gracePeriod() {
+			continue
+		}
+
+		if m.config.GC.DryRun {
+			dlog.Infof("Dry run: orphaned device %s on instance %s would be deleted",
+				device.ID,
+				device.InstanceID)
+			continue
+		}
+		if err := m.cloud.DeviceDelete(device.InstanceID, device.ID); err != nil {
+			dlog.Errorf("Failed to delete orphaned device %s: %v", device.ID, err)
+			continue
+		}
+		dlog.Infof("Deleted orphaned device %s from instance %s",
+			device.ID,
+			device.InstanceID)
+		m.dropOrphan(device.ID)
+	}
+
+	// Forget the orphans which are in use again or were deleted
+	for _, orphan := range m.Orphans() {
+		if !orphan.Adopt && (known[orphan.DeviceID] || !listed[orphan.DeviceID]) {
+			m.dropOrphan(orphan.DeviceID)
+		}
+	}
+	return nil
+}
+
+// setCreating records whether the device is being created by a plan
+func (m *Manager) setCreating(deviceID string, creating bool) {
+	m.creatingLock.Lock()
+	defer m.creatingLock.Unlock()
+
+	if creating {
+		m.creating[deviceID] = true
+	} else {
+		delete(m.creating, deviceID)
+	}
+}
+
+// creatingDevices returns the IDs of the devices being created by plans
+func (m *Manager) creatingDevices() map[string]bool {
+	m.creatingLock.Lock()
+	defer m.creatingLock.Unlock()
+
+	devices := make(map[string]bool, len(m.creating))
+	for id := range m.creating {
+		devices[id] = true
+	}
+	return devices
+}
@@ -0,0 +1,234 @@
+/*
+Package inframanager provides an interface to the infrastrcture manager
+Copyright 2018 Portworx
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package inframanager
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/libopenstorage/rico/pkg/cloudprovider"
+	cloudfake "github.com/libopenstorage/rico/pkg/cloudprovider/fake"
+	"github.com/libopenstorage/rico/pkg/storageprovider"
+	"github.com/libopenstorage/rico/pkg/storageprovider/fake"
+)
+
+func TestCollectGarbage(t *testing.T) {
+	cloud := cloudfake.New()
+	ids := make([]string, 4)
+	for i := range ids {
+		d, err := cloud.DeviceCreate("i-1", &cloudprovider.DeviceSpecs{Size: 8})
+		assert.NoError(t, err)
+		ids[i] = d.ID
+	}
+	nodes := newTestNodes("i-1")
+	nodes[0].Devices = []*storageprovider.Device{
+		{Size: 8, Metadata: storageprovider.DeviceMetadata{ID: ids[0]}},
+	}
+	storage := fake.New(&storageprovider.Topology{
+		Cluster: storageprovider.StorageCluster{
+			StorageNodes: nodes,
+		},
+	})
+	im := NewManager(&Config{
+		GC: GCConfig{
+			Interval:    time.Minute,
+			GracePeriod: time.Hour,
+			DryRun:      true,
+		},
+	}, cloud, storage)
+	now := time.Now()
+	im.now = func() time.Time { return now }
+
+	// Devices unknown to the storage system are orphans
+	im.addOrphan("i-1", ids[3], "Node i-1 left the storage system", true)
+	assert.NoError(t, im.collectGarbage())
+	orphans := im.Orphans()
+	assert.Len(t, orphans, 3)
+	assert.Equal(t, ids[1], orphans[0].DeviceID)
+	assert.Equal(t, "i-1", orphans[0].InstanceID)
+	assert.Equal(t, now, orphans[0].Detected)
+
+	// Orphans which are in use again are forgotten
+	nodes[0].Devices = append(nodes[0].Devices, &storageprovider.Device{
+		Size:     8,
+		Metadata: storageprovider.DeviceMetadata{ID: ids[2]},
+	})
+	assert.NoError(t, im.collectGarbage())
+	assert.Len(t, im.Orphans(), 2)
+
+	// Nothing is deleted during the grace period or in dry run
+	assert.NoError(t, im.collectGarbage())
+	assert.Equal(t, 4, cloud.NumDevices())
+	now = now.Add(2 * time.Hour)
+	assert.NoError(t, im.collectGarbage())
+	assert.Equal(t, 4, cloud.NumDevices())
+
+	// Orphans kept for adoption are not deleted
+	im.config.GC.DryRun = false
+	assert.NoError(t, im.collectGarbage())
+	assert.Equal(t, 3, cloud.NumDevices())
+	orphans = im.Orphans()
+	assert.Len(t, orphans, 1)
+	assert.Equal(t, ids[3], orphans[0].DeviceID)
+}
+
+func TestCollectGarbageOtherCluster(t *testing.T) {
+	cloud := cloudfake.New()
+	cloud.Cluster = "cluster-1"
+	d, err := cloud.DeviceCreate("i-1", &cloudprovider.DeviceSpecs{Size: 8})
+	assert.NoError(t, err)
+
+	// A volume of another cluster in the same account
+	other := &cloudprovider.Device{ID: "vol-other", Size: 8}
+	cloud.Devices["i-2"] = []*cloudprovider.Device{other}
+	cloud.Clusters[other.ID] = "cluster-2"
+
+	storage := fake.New(&storageprovider.Topology{
+		Cluster: storageprovider.StorageCluster{
+			StorageNodes: newTestNodes("i-1"),
+		},
+	})
+	im := NewManager(&Config{
+		GC: GCConfig{
+			Interval:    time.Minute,
+			GracePeriod: time.Hour,
+		},
+	}, cloud, storage)
+	now := time.Now()
+	im.now = func() time.Time { return now }
+
+	// Only the volume of the cluster is collected
+	assert.NoError(t, im.collectGarbage())
+	orphans := im.Orphans()
+	assert.Len(t, orphans, 1)
+	assert.Equal(t, d.ID, orphans[0].DeviceID)
+	now = now.Add(2 * time.Hour)
+	assert.NoError(t, im.collectGarbage())
+	assert.Len(t, im.Orphans(), 0)
+	assert.Equal(t, 1, cloud.NumDevices())
+	assert.Equal(t, []*cloudprovider.Device{other}, cloud.Devices["i-2"])
+}
+
+func TestCollectGarbageNodeLeft(t *testing.T) {
+	cloud := cloudfake.New()
+	d, err := cloud.DeviceCreate("i-2", &cloudprovider.DeviceSpecs{Size: 8})
+	assert.NoError(t, err)
+	nodes := newTestNodes("i-1", "i-2")
+	nodes[1].Devices = []*storageprovider.Device{
+		{Size: 8, Metadata: storageprovider.DeviceMetadata{ID: d.ID}},
+	}
+	storage := fake.New(&storageprovider.Topology{
+		Cluster: storageprovider.StorageCluster{
+			StorageNodes: nodes,
+		},
+	})
+	class := Class{
+		Name:          "gp2",
+		WatermarkHigh: 75,
+		WatermarkLow:  25,
+		DiskSets:      1,
+		DiskSizeGb:    8,
+	}
+	im := NewManager(&Config{
+		Classes: []Class{class},
+		GC: GCConfig{
+			Interval: time.Minute,
+		},
+	}, cloud, storage)
+	now := time.Now()
+	im.now = func() time.Time { return now }
+	assert.NoError(t, im.do(&class))
+
+	// The garbage collector finds the device before the class does
+	storage.Topology.Cluster.StorageNodes = nodes[:1]
+	assert.NoError(t, im.collectGarbage())
+	assert.NoError(t, im.collectGarbage())
+	assert.Equal(t, 1, cloud.NumDevices())
+	assert.NoError(t, im.do(&class))
+	orphans := im.Orphans()
+	assert.Len(t, orphans, 1)
+	assert.True(t, orphans[0].Adopt)
+	assert.Contains(t, orphans[0].Reason, "left")
+
+	// The device is kept for adoption
+	now = now.Add(2 * time.Hour)
+	assert.NoError(t, im.collectGarbage())
+	assert.Equal(t, 1, cloud.NumDevices())
+}
+
+// addHookStorage calls beforeAdd before adding a device
+type addHookStorage struct {
+	*fake.Fake
+	beforeAdd func()
+}
+
+func (s *addHookStorage) DeviceAdd(
+	node *storageprovider.StorageNode,
+	device *storageprovider.Device,
+) error {
+	s.beforeAdd()
+	return s.Fake.DeviceAdd(node, device)
+}
+
+func TestCollectGarbageCreating(t *testing.T) {
+	cloud := cloudfake.New()
+	storage := &addHookStorage{
+		Fake: fake.New(&storageprovider.Topology{
+			Cluster: storageprovider.StorageCluster{
+				StorageNodes: newTestNodes("i-1"),
+			},
+		}),
+	}
+	storage.CurrentUtilization = 80
+	class := Class{
+		Name:          "gp2",
+		WatermarkHigh: 75,
+		WatermarkLow:  25,
+		DiskSets:      1,
+		DiskSizeGb:    8,
+	}
+	im := NewManager(&Config{
+		Classes: []Class{class},
+		GC: GCConfig{
+			Interval:    time.Minute,
+			GracePeriod: time.Nanosecond,
+		},
+	}, cloud, storage)
+	now := time.Now()
+	im.now = func() time.Time { return now }
+
+	// Devices created but not yet added are not orphans
+	storage.beforeAdd = func() {
+		assert.NoError(t, im.collectGarbage())
+		now = now.Add(time.Second)
+		assert.NoError(t, im.collectGarbage())
+		assert.Len(t, im.Orphans(), 0)
+	}
+	plan, err := im.Plan("gp2")
+	assert.NoError(t, err)
+	applied, err := im.apply(&class, im.state(&class), plan)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, applied)
+	assert.Equal(t, 1, cloud.NumDevices())
+	assert.Equal(t, 1, storage.NumDevices())
+
+	storage.beforeAdd = func() {}
+	assert.NoError(t, im.collectGarbage())
+	assert.Len(t, im.Orphans(), 0)
+}
@@ -18,6 +18,7 @@ package inframanager
 
 import (
 	"fmt"
+	"math/rand"
 	"sync"
 	"time"
 
@@ -27,6 +28,15 @@ import (
 	"github.com/libopenstorage/rico/pkg/storageprovider"
 )
 
+const (
+	// Default time between checks of a class
+	defaultInterval = time.Second
+
+	// When no MaxBackoff is configured, failing checks slow down to at
+	// most this many times the interval
+	defaultMaxBackoffFactor = 32
+)
+
 // Class defines the type of storage to use for the appropriate
 // cloud provider
 type Class struct {
@@ -49,6 +59,247 @@ type Class struct {
 	// Size of the disk to add
 	// TODO: This may be adjusted in future changes
 	DiskSizeGb uint64
+
+	// Placement is the name of the algorithm used to choose the nodes
+	// for new devices. Defaults to PlacementLeastDevices.
+	Placement string
+
+	// Spread determines how the devices of a disk set are spread across
+	// failure domains. Defaults to SpreadNone.
+	Spread SpreadPolicy
+
+	// SpreadLevel is the failure domain level the devices of a disk set
+	// are spread across. Defaults to storageprovider.LevelZone.
+	SpreadLevel storageprovider.FailureDomainLevel
+
+	// SpreadWithin, when set, places all the devices of a disk set in a
+	// single failure domain at this level. It must be above SpreadLevel,
+	// for example spreading across racks within a zone.
+	SpreadWithin storageprovider.FailureDomainLevel
+
+	// Removal is the name of the algorithm used to choose the device
+	// to remove. Defaults to RemovalLeastUtilized.
+	Removal string
+
+	// MinDevicesPerNode keeps devices from being removed from nodes
+	// which have this many devices or fewer. Set it to 1 to never remove
+	// the last device of a node.
+	MinDevicesPerNode int
+
+	// MinDevicesPerDomain keeps devices of the class from being removed
+	// from failure domains at RemovalLevel which have this many devices
+	// of the class or fewer
+	MinDevicesPerDomain int
+
+	// RemovalLevel is the failure domain level used by
+	// MinDevicesPerDomain. Defaults to storageprovider.LevelZone.
+	RemovalLevel storageprovider.FailureDomainLevel
+
+	// NodeSelector limits new devices to the nodes which have all of
+	// these labels
+	NodeSelector map[string]string
+
+	// Affinity attracts new devices to the nodes matching its rules
+	Affinity NodeAffinity
+
+	// AntiAffinity keeps new devices away from the nodes matching its
+	// rules
+	AntiAffinity NodeAffinity
+
+	// ScaleUpCooldown is the minimum time between adding storage
+	ScaleUpCooldown time.Duration
+
+	// ScaleDownCooldown is the minimum time after any scaling action
+	// before storage is removed
+	ScaleDownCooldown time.Duration
+
+	// StabilizationSamples is the number of consecutive samples which
+	// must be beyond a watermark before storage is added or removed
+	StabilizationSamples int
+
+	// ScaleUpSteps add more disk sets at a time when utilization is
+	// further above WatermarkHigh. One disk set is added if none apply.
+	ScaleUpSteps []ScalingStep
+
+	// ScaleDownSteps remove more devices at a time when utilization is
+	// further below WatermarkLow. One device is removed if none apply.
+	ScaleDownSteps []ScalingStep
+
+	// TargetUtilization, when set, computes from the capacity of the
+	// class how many disk sets to add, or devices to remove, to bring
+	// utilization back to this value in a single check. The watermarks
+	// still decide when to act. Takes precedence over the scaling steps.
+	TargetUtilization int
+
+	// MinDevices and MaxDevices bound the number of devices of the class
+	MinDevices int
+	MaxDevices int
+
+	// MinCapacityGb and MaxCapacityGb bound the total size of the
+	// devices of the class
+	MinCapacityGb uint64
+	MaxCapacityGb uint64
+
+	// MaxDevicesPerNode is the most devices of the class on a node
+	MaxDevicesPerNode int
+
+	// NodeBaseline is the number of devices of the class given to each
+	// node which joins the storage system
+	NodeBaseline int
+
+	// NodeLeave decides what happens to the devices of the class on a
+	// node which left the storage system. Devices with no class follow
+	// the policy of the first class.
+	NodeLeave NodeLeavePolicy
+
+	// DrainTimeout is how long the storage system may take to move the
+	// data off a device being removed before the removal is aborted.
+	// Drains never time out if not set.
+	DrainTimeout time.Duration
+
+	// ExpandDevices grows the existing devices of the class up to
+	// MaxDeviceSizeGb before adding new devices
+	ExpandDevices bool
+
+	// MaxDeviceSizeGb is the largest size devices are expanded to
+	MaxDeviceSizeGb uint64
+
+	// ExpandStepGb is how much a device grows each time it is expanded.
+	// Defaults to DiskSizeGb.
+	ExpandStepGb uint64
+
+	// ExpandInterval is the minimum time between resizes of a device.
+	// Defaults to six hours, the most often EBS allows a volume to be
+	// modified.
+	ExpandInterval time.Duration
+
+	// Predictive adds storage before utilization crosses WatermarkHigh
+	// by projecting its trend
+	Predictive PredictiveConfig
+
+	// Approval queues the plans of the class until they are approved
+	Approval ApprovalConfig
+
+	// Interval is the time between checks of the class. Defaults to
+	// Config.Interval.
+	Interval time.Duration
+
+	// Jitter adds a random delay of up to this long to each interval
+	Jitter time.Duration
+
+	// MaxBackoff is the longest interval used when checks keep failing.
+	// The interval doubles after each failure. Defaults to 32 times
+	// the interval.
+	MaxBackoff time.Duration
+
+	// Scheduler configures the filter and score plugins used when
+	// Placement is PlacementScheduler
+	Scheduler SchedulerConfig
+}
+
+// validate checks the configuration of the class
+func (c *Class) validate() error {
+	if _, err := getPlacement(c); err != nil {
+		return err
+	}
+	if _, err := getRemoval(c); err != nil {
+		return err
+	}
+	if _, err := getFilters(c.Scheduler.Filters); err != nil {
+		return fmt.Errorf("Invalid scheduler for class %s: %v", c.Name, err)
+	}
+	if _, err := getScores(c); err != nil {
+		return err
+	}
+
+	if err := validateSteps(c.ScaleUpSteps); err != nil {
+		return fmt.Errorf("Invalid scale up steps for class %s: %v", c.Name, err)
+	}
+	if err := validateSteps(c.ScaleDownSteps); err != nil {
+		return fmt.Errorf("Invalid scale down steps for class %s: %v", c.Name, err)
+	}
+	if err := c.validateLimits(); err != nil {
+		return err
+	}
+	if err := c.validateExpand(); err != nil {
+		return err
+	}
+	if err := c.validateNodes(); err != nil {
+		return err
+	}
+	if c.TargetUtilization < 0 || c.TargetUtilization > 100 {
+		return fmt.Errorf("Target utilization of class %s must be between 0 and 100",
+			c.Name)
+	}
+	if err := c.Predictive.validate(); err != nil {
+		return fmt.Errorf("Invalid predictive scaling for class %s: %v", c.Name, err)
+	}
+	if err := c.Approval.validate(); err != nil {
+		return fmt.Errorf("Invalid approval for class %s: %v", c.Name, err)
+	}
+	if err := c.Affinity.validate(); err != nil {
+		return fmt.Errorf("Invalid affinity for class %s: %v", c.Name, err)
+	}
+	if err := c.AntiAffinity.validate(); err != nil {
+		return fmt.Errorf("Invalid anti-affinity for class %s: %v", c.Name, err)
+	}
+
+	switch c.Spread {
+	case SpreadNone, SpreadPreferred, SpreadRequired:
+	default:
+		return fmt.Errorf("Unknown spread policy %s for class %s",
+			c.Spread,
+			c.Name)
+	}
+
+	levels := []storageprovider.FailureDomainLevel{
+		c.SpreadLevel,
+		c.SpreadWithin,
+		c.RemovalLevel,
+	}
+	for _, level := range levels {
+		if len(level) != 0 && levelIndex(level) < 0 {
+			return fmt.Errorf("Unknown failure domain level %s for class %s",
+				level,
+				c.Name)
+		}
+	}
+	if len(c.SpreadWithin) != 0 &&
+		levelIndex(c.SpreadWithin) >= levelIndex(c.spreadLevel()) {
+		return fmt.Errorf("Class %s spreads across %s which is not within %s",
+			c.Name,
+			c.spreadLevel(),
+			c.SpreadWithin)
+	}
+
+	return nil
+}
+
+// spreadLevel returns the failure domain level disk sets are spread across
+func (c *Class) spreadLevel() storageprovider.FailureDomainLevel {
+	if len(c.SpreadLevel) == 0 {
+		return storageprovider.LevelZone
+	}
+	return c.SpreadLevel
+}
+
+// removalLevel returns the failure domain level used by MinDevicesPerDomain
+func (c *Class) removalLevel() storageprovider.FailureDomainLevel {
+	if len(c.RemovalLevel) == 0 {
+		return storageprovider.LevelZone
+	}
+	return c.RemovalLevel
+}
+
+// levelIndex returns the position of the level in the failure domain
+// hierarchy, or -1 if it is unknown
+func levelIndex(level storageprovider.FailureDomainLevel) int {
+	for i, l := range storageprovider.FailureDomainLevels {
+		if l == level {
+			return i
+		}
+	}
+	return -1
 }
 
 // Config contains all the configuration settings
@@ -56,16 +307,46 @@ type Config struct {
 
 	// Classes of storage to manage
 	Classes []Class
+
+	// Interval is the default time between checks of a class.
+	// Defaults to one second.
+	Interval time.Duration
+
+	// GC configures the garbage collector of orphaned cloud devices
+	GC GCConfig
+
+	// DryRun makes all the decisions without changing the cloud or the
+	// storage system. The calls which would have been made are
+	// available from Manager.DryRunCalls.
+	DryRun bool
 }
 
 // Manager is an implementation of inframanager.Interface
 type Manager struct {
-	config  Config
-	lock    sync.Mutex
-	running bool
-	quit    chan struct{}
-	cloud   cloudprovider.Interface
-	storage storageprovider.Interface
+	// Number of plans computed. Kept first for 64-bit atomic alignment.
+	plans uint64
+
+	config     Config
+	lock       sync.Mutex
+	running    bool
+	quit       chan struct{}
+	cloud      cloudprovider.Interface
+	storage    storageprovider.Interface
+	statesLock sync.Mutex
+	states     map[string]*classState
+	now        func() time.Time
+	dryRun     *dryRunRecorder
+
+	orphansLock sync.Mutex
+	orphans     map[string]*Orphan
+
+	// Devices created by plans but not yet added to the storage system
+	creatingLock sync.Mutex
+	creating     map[string]bool
+
+	// Last resize of each device, by device ID
+	resizedLock sync.Mutex
+	resized     map[string]time.Time
 }
 
 // NewManager returns a new infrastructure manager implementation
@@ -74,11 +355,31 @@ func NewManager(
 	cloud cloudprovider.Interface,
 	storage storageprovider.Interface,
 ) *Manager {
-	return &Manager{
-		config:  *config,
-		cloud:   cloud,
-		storage: storage,
+	m := &Manager{
+		config:   *config,
+		cloud:    cloud,
+		storage:  storage,
+		states:   make(map[string]*classState),
+		now:      time.Now,
+		orphans:  make(map[string]*Orphan),
+		creating: make(map[string]bool),
+		resized:  make(map[string]time.Time),
+	}
+	for i := range m.config.Classes {
+		m.state(&m.config.Classes[i])
 	}
+	if config.DryRun {
+		m.dryRun = &dryRunRecorder{}
+		m.cloud = &dryRunCloud{
+			cloud:    cloud,
+			recorder: m.dryRun,
+		}
+		m.storage = &dryRunStorage{
+			storage:  storage,
+			recorder: m.dryRun,
+		}
+	}
+	return m
 }
 
 // Start starts the eventloop
@@ -90,13 +391,33 @@ func (m *Manager) Start() error {
 		return fmt.Errorf("already running")
 	}
 
+	// Check configuration
+	for i := range m.config.Classes {
+		if err := m.config.Classes[i].validate(); err != nil {
+			return err
+		}
+	}
+
+	quit := make(chan struct{})
+	triggers := make(classTriggers)
+	for _, class := range m.config.Classes {
+		triggers[class.Name] = make(chan struct{}, 1)
+	}
+	if err := m.subscribe(quit, triggers); err != nil {
+		return fmt.Errorf("Failed to subscribe to storage events: %v", err)
+	}
+
+	if m.config.GC.Interval > 0 {
+		go m.gcloop(quit)
+	}
+
 	m.running = true
-	m.quit = make(chan struct{})
+	m.quit = quit
 
 	// Start eventloops
 	for _, class := range m.config.Classes {
 		started := make(chan bool)
-		go m.eventloop(started, class)
+		go m.eventloop(started, class, triggers[class.Name])
 		<-started
 	}
 	return nil
@@ -120,124 +441,244 @@ func (m *Manager) IsRunning() bool {
 	return m.running
 }
 
-func (m *Manager) eventloop(started chan<- bool, class Class) {
-	dlog.Infoln("Started loop")
+func (m *Manager) eventloop(started chan<- bool, class Class, trigger <-chan struct{}) {
+	dlog.Infof("Started loop for class %s", class.Name)
 	started <- true
 
-	// This event loop is JUST a place holder. This is
-	// still under development.
-	ticker := time.NewTicker(time.Second)
+	failures := 0
+	timer := time.NewTimer(m.interval(&class, failures))
+	defer timer.Stop()
 	for {
 		select {
 		case <-m.quit:
-			dlog.Infoln("Stopped loop")
+			dlog.Infof("Stopped loop for class %s", class.Name)
 			return
-		case <-ticker.C:
-			if err := m.do(&class); err != nil {
-				dlog.Errorln("%v")
+		case <-trigger:
+			if !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
+				}
 			}
+		case <-timer.C:
+		}
+
+		if err := m.do(&class); err != nil {
+			dlog.Errorf("Class %s: %v", class.Name, err)
+			failures++
+		} else {
+			failures = 0
 		}
+		timer.Reset(m.interval(&class, failures))
 	}
 }
 
-func (m *Manager) do(class *Class) error {
-	// Calculate utilization
-	utilization, err := m.storage.Utilization()
-	if err != nil {
-		return fmt.Errorf("Failed to get utilization: %v", err)
+// interval returns the time until the next check of the class. The
+// interval doubles for each consecutive failure up to the maximum
+// backoff, then the jitter is added.
+func (m *Manager) interval(class *Class, failures int) time.Duration {
+	interval := class.Interval
+	if interval <= 0 {
+		interval = m.config.Interval
+	}
+	if interval <= 0 {
+		interval = defaultInterval
 	}
 
-	if utilization > class.WatermarkHigh {
-		return m.addStorage(class)
-	} else if utilization < class.WatermarkLow {
-		return m.removeStorage(class)
+	maxBackoff := class.MaxBackoff
+	if maxBackoff <= 0 {
+		maxBackoff = defaultMaxBackoffFactor * interval
+	}
+	for i := 0; i < failures && interval < maxBackoff; i++ {
+		interval *= 2
+	}
+	if interval > maxBackoff {
+		interval = maxBackoff
 	}
 
-	return nil
+	if class.Jitter > 0 {
+		interval += time.Duration(rand.Int63n(int64(class.Jitter)))
+	}
+	return interval
 }
 
-func (m *Manager) addStorage(class *Class) error {
-	t, err := m.storage.GetTopology()
+func (m *Manager) do(class *Class) error {
+	// Calculate utilization
+	utilization, err := m.utilization(class)
 	if err != nil {
-		return fmt.Errorf("Failed to get topology: %v", err)
+		return fmt.Errorf("Failed to get utilization: %v", err)
 	}
 
-	if len(t.Cluster.StorageNodes) == 0 {
-		return fmt.Errorf("Cluster has no storage nodes")
+	state := m.state(class)
+	state.lock.Lock()
+	defer state.lock.Unlock()
+
+	now := m.now()
+	m.record(class, state, utilization, now)
+	m.checkDrains(class, state)
+	if err := m.reconcileNodes(class, state, utilization); err != nil {
+		// Keep scaling the class even if the new nodes did not get
+		// their baseline
+		dlog.Errorf("Class %s: Failed to reconcile nodes: %v", class.Name, err)
 	}
 
-	// TODO: Get nodes from multiple separate zones
-	for set := 0; set < class.DiskSets; set++ {
-		// Pick a node
-		// TODO: This will be an inteface to a new algorithm object
-		node := t.Cluster.StorageNodes[0]
-		for _, currentNode := range t.Cluster.StorageNodes {
-			if len(currentNode.Devices) < len(node.Devices) {
-				node = currentNode
-			}
+	// Wait for the pending plan to be approved, or after a rejection
+	if (state.pending != nil && !m.expired(state)) || m.rejected(state) {
+		return nil
+	}
+
+	if high, reason := m.high(class, state, utilization); high {
+		state.lowSamples = 0
+		state.highSamples++
+		if state.highSamples < class.StabilizationSamples ||
+			now.Sub(state.status.LastScaleUp) < class.ScaleUpCooldown {
+			return nil
 		}
 
-		// Create and attach a disk to the node
-		device, err := m.cloud.DeviceCreate(node.Metadata.ID, &cloudprovider.DeviceSpecs{
-			Size:       class.DiskSizeGb,
-			Parameters: class.Parameters,
-		})
+		state.highSamples = 0
+		plan, err := m.planAdd(class, state, utilization, reason)
 		if err != nil {
-			return fmt.Errorf("Failed to add disk to node %s: %v",
-				node.Metadata.ID,
-				err)
+			return err
+		}
+		if needsApproval(class, plan) {
+			m.queue(class, state, plan)
+			return nil
+		}
+		applied, err := m.apply(class, state, plan)
+		if err == nil || scalesUp(plan.Steps[:applied]) {
+			state.status.LastScaleUp = now
+		}
+		if err != nil {
+			return err
+		}
+		if state.status.AttachmentSaturated {
+			return ErrAttachmentSaturated
+		}
+	} else if utilization < class.WatermarkLow {
+		state.highSamples = 0
+		state.lowSamples++
+		if state.lowSamples < class.StabilizationSamples ||
+			len(state.drains) != 0 ||
+			now.Sub(state.status.LastScaleUp) < class.ScaleDownCooldown ||
+			now.Sub(state.status.LastScaleDown) < class.ScaleDownCooldown {
+			return nil
 		}
 
-		// Notify storage system device has been added
-		err = m.storage.DeviceAdd(node, &storageprovider.Device{
-			Path: device.Path,
-			Size: device.Size,
-			Metadata: storageprovider.DeviceMetadata{
-				ID: device.ID,
-			},
-		})
+		state.lowSamples = 0
+		plan, err := m.planRemove(class, state, utilization, lowReason(class, utilization))
+		if err != nil {
+			return err
+		}
+		if needsApproval(class, plan) {
+			m.queue(class, state, plan)
+			return nil
+		}
+		applied, err := m.apply(class, state, plan)
+		if applied > 0 {
+			state.status.LastScaleDown = now
+		}
+		if err != nil {
+			return err
+		}
+	} else {
+		state.highSamples = 0
+		state.lowSamples = 0
 	}
 
 	return nil
 }
 
-func (m *Manager) removeStorage(class *Class) error {
-	t, err := m.storage.GetTopology()
-	if err != nil {
-		return fmt.Errorf("Failed to get topology: %v", err)
+// record keeps the utilization sample when the class uses predictive
+// scaling
+func (m *Manager) record(
+	class *Class,
+	state *classState,
+	utilization int,
+	now time.Time,
+) {
+	if class.Predictive.Model == TrendNone {
+		return
 	}
+	state.history.record(utilizationSample{
+		time:        now,
+		utilization: float64(utilization),
+	}, class.Predictive.HistorySize)
+}
 
-	if len(t.Cluster.StorageNodes) == 0 {
-		return fmt.Errorf("Cluster has no storage nodes")
-	}
-
-	// Pick a device
-	// This is a silly algorithm for now
-	// TODO: This will be an inteface to a new algorithm object
-	var device *storageprovider.Device
-	var node *storageprovider.StorageNode
-	for _, currentNode := range t.Cluster.StorageNodes {
-		for _, currentDevice := range currentNode.Devices {
-			if device == nil {
-				node = currentNode
-				device = currentDevice
-			} else if currentDevice.Utilization < device.Utilization {
-				node = currentNode
-				device = currentDevice
+// high returns true and the reason if storage should be added to the
+// class, either because utilization is above the high watermark or,
+// with predictive scaling, because it is projected to cross the high
+// watermark within the lead time
+func (m *Manager) high(class *Class, state *classState, utilization int) (bool, string) {
+	high := utilization > class.WatermarkHigh
+	if class.Predictive.Model != TrendNone {
+		t, ok := state.history.fit(&class.Predictive)
+		if !ok {
+			state.status.TimeToFull = -1
+		} else {
+			state.status.TimeToFull = t.timeTo(100)
+			timeToHigh := t.timeTo(float64(class.WatermarkHigh))
+			if timeToHigh >= 0 && timeToHigh <= class.Predictive.LeadTime {
+				high = true
 			}
 		}
 	}
+	if !high {
+		return false, ""
+	}
+	return true, highReason(class, utilization)
+}
 
-	// Nothing to do
-	if device == nil {
-		return nil
+// utilization returns the utilization of the class, or of the whole
+// cluster if the storage provider cannot break it down by class
+func (m *Manager) utilization(class *Class) (int, error) {
+	utilization, err := m.storage.ClassUtilization(class.Name)
+	if err == storageprovider.ErrNotSupported {
+		return m.storage.Utilization()
 	}
+	return utilization, err
+}
 
-	// Remove drive from the storage system
-	if err = m.storage.DeviceRemove(node, device); err != nil {
-		return err
+// topology returns a copy of the storage topology which can be changed
+// as devices are added or removed
+func (m *Manager) topology() (*storageprovider.Topology, error) {
+	t, err := m.storage.GetTopology()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get topology: %v", err)
+	}
+	if len(t.Cluster.StorageNodes) == 0 {
+		return nil, fmt.Errorf("Cluster has no storage nodes")
 	}
 
-	// Delete cloud drive
-	return m.cloud.DeviceDelete(node.Metadata.ID, device.Metadata.ID)
+	nodes := make([]*storageprovider.StorageNode, len(t.Cluster.StorageNodes))
+	for i, node := range t.Cluster.StorageNodes {
+		n := *node
+		n.Devices = make([]*storageprovider.Device, len(node.Devices))
+		copy(n.Devices, node.Devices)
+		nodes[i] = &n
+	}
+	return &storageprovider.Topology{
+		Cluster: storageprovider.StorageCluster{
+			StorageNodes: nodes,
+			Private:      t.Cluster.Private,
+		},
+	}, nil
+}
+
+// attachmentCapacity returns the number of devices each node can still
+// attach according to the cloud provider
+func (m *Manager) attachmentCapacity(
+	t *storageprovider.Topology,
+) (map[*storageprovider.StorageNode]int, error) {
+	capacity := make(map[*storageprovider.StorageNode]int)
+	for _, node := range t.Cluster.StorageNodes {
+		c, err := m.cloud.AttachmentCapacity(node.Metadata.ID)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to get attachment capacity of node %s: %v",
+				node.Metadata.ID,
+				err)
+		}
+		capacity[node] = c
+	}
+	return capacity, nil
 }
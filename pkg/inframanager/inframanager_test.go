@@ -20,15 +20,20 @@ import (
 	"os"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 
 	"github.com/libopenstorage/rico/pkg/storageprovider"
 
 	"github.com/libopenstorage/rico/pkg/cloudprovider/aws"
+	cloudfake "github.com/libopenstorage/rico/pkg/cloudprovider/fake"
 	"github.com/libopenstorage/rico/pkg/storageprovider/fake"
 )
 
+// TestWithAws needs AWS_DEFAULT_REGION, RICO_TEST_INSTANCES as described
+// in the AWS cloud provider tests, and RICO_CLUSTER_ID with the cluster
+// the volumes are tagged with, e.g. export RICO_CLUSTER_ID=rico-test
 func TestWithAws(t *testing.T) {
 	inputInstances := os.Getenv("RICO_TEST_INSTANCES")
 	if len(inputInstances) == 0 {
@@ -56,6 +61,9 @@ func TestWithAws(t *testing.T) {
 	// Create providers
 	storage := fake.New(topology)
 	cloud := aws.NewProvider()
+	if cloud == nil {
+		t.Skipf("Must provide AWS_DEFAULT_REGION and RICO_CLUSTER_ID")
+	}
 	class := Class{
 		Name:          "gp2",
 		WatermarkHigh: 75,
@@ -97,3 +105,275 @@ func TestWithAws(t *testing.T) {
 		assert.Equal(t, 2*numInstances-(i+1), storage.NumDevices())
 	}
 }
+
+func newTestNodes(ids ...string) []*storageprovider.StorageNode {
+	nodes := make([]*storageprovider.StorageNode, len(ids))
+	for i, id := range ids {
+		nodes[i] = &storageprovider.StorageNode{
+			Name: id,
+			Metadata: storageprovider.InstanceMetadata{
+				ID: id,
+			},
+		}
+	}
+	return nodes
+}
+
+func TestAddRemoveStorage(t *testing.T) {
+	storage := fake.New(&storageprovider.Topology{
+		Cluster: storageprovider.StorageCluster{
+			StorageNodes: newTestNodes("i-1", "i-2", "i-3"),
+		},
+	})
+	class := Class{
+		Name:          "gp2",
+		WatermarkHigh: 75,
+		WatermarkLow:  25,
+		DiskSets:      3,
+		DiskSizeGb:    8,
+	}
+	cloud := cloudfake.New()
+	im := NewManager(&Config{Classes: []Class{class}}, cloud, storage)
+
+	storage.CurrentUtilization = 80
+	assert.NoError(t, im.do(&class))
+	assert.Equal(t, 3, storage.NumDevices())
+	assert.Equal(t, 3, cloud.NumDevices())
+	for _, node := range storage.Topology.Cluster.StorageNodes {
+		assert.Len(t, node.Devices, 1)
+	}
+
+	storage.CurrentUtilization = 10
+	assert.NoError(t, im.do(&class))
+	assert.Equal(t, 2, storage.NumDevices())
+	assert.Equal(t, 2, cloud.NumDevices())
+}
+
+func TestAddStorageHonorsNodeClasses(t *testing.T) {
+	nodes := newTestNodes("i-1", "i-2", "i-3")
+	nodes[0].Classes = []string{"gp2"}
+	nodes[1].Classes = []string{"io1", "gp2"}
+	storage := fake.New(&storageprovider.Topology{
+		Cluster: storageprovider.StorageCluster{
+			StorageNodes: nodes,
+		},
+	})
+	storage.CurrentUtilization = 80
+	io1 := Class{
+		Name:          "io1",
+		WatermarkHigh: 75,
+		DiskSets:      2,
+		DiskSizeGb:    8,
+	}
+	st1 := Class{
+		Name:          "st1",
+		WatermarkHigh: 75,
+		DiskSets:      1,
+		DiskSizeGb:    8,
+	}
+	im := NewManager(&Config{Classes: []Class{io1, st1}}, cloudfake.New(), storage)
+
+	// Only i-2 and i-3 may receive io1 devices
+	assert.NoError(t, im.do(&io1))
+	assert.Len(t, nodes[0].Devices, 0)
+	assert.Len(t, nodes[1].Devices, 1)
+	assert.Len(t, nodes[2].Devices, 1)
+
+	// No node supports st1
+	nodes[2].Classes = []string{"gp2"}
+	err := im.do(&st1)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "st1")
+}
+
+func TestAddStorageAttachmentSaturated(t *testing.T) {
+	storage := fake.New(&storageprovider.Topology{
+		Cluster: storageprovider.StorageCluster{
+			StorageNodes: newTestNodes("i-1", "i-2"),
+		},
+	})
+	storage.CurrentUtilization = 80
+	cloud := cloudfake.New()
+	cloud.AttachmentLimit = 2
+	class := Class{
+		Name:          "gp2",
+		WatermarkHigh: 75,
+		DiskSets:      1,
+		DiskSizeGb:    8,
+	}
+	im := NewManager(&Config{Classes: []Class{class}}, cloud, storage)
+
+	for i := 0; i < 4; i++ {
+		assert.NoError(t, im.do(&class))
+	}
+	status, err := im.Status("gp2")
+	assert.NoError(t, err)
+	assert.False(t, status.AttachmentSaturated)
+
+	// Every node is full
+	assert.Equal(t, ErrAttachmentSaturated, im.do(&class))
+	assert.Equal(t, 4, cloud.NumDevices())
+	status, err = im.Status("gp2")
+	assert.NoError(t, err)
+	assert.True(t, status.AttachmentSaturated)
+
+	// A set cannot use the same node more than its capacity allows
+	storage.Topology.Cluster.StorageNodes = append(
+		storage.Topology.Cluster.StorageNodes,
+		newTestNodes("i-3")...)
+	class.DiskSets = 3
+	assert.Error(t, im.do(&class))
+	assert.Equal(t, 4, cloud.NumDevices())
+
+	_, err = im.Status("unknown")
+	assert.Error(t, err)
+}
+
+func TestAddStoragePartiallySaturated(t *testing.T) {
+	storage := fake.New(&storageprovider.Topology{
+		Cluster: storageprovider.StorageCluster{
+			StorageNodes: newTestNodes("i-1", "i-2"),
+		},
+	})
+	storage.CurrentUtilization = 80
+	cloud := cloudfake.New()
+	cloud.AttachmentLimit = 1
+	class := Class{
+		Name:            "gp2",
+		WatermarkHigh:   75,
+		DiskSets:        1,
+		DiskSizeGb:      8,
+		ScaleUpCooldown: time.Minute,
+		ScaleUpSteps:    []ScalingStep{{Utilization: 75, Count: 3}},
+	}
+	im := NewManager(&Config{Classes: []Class{class}}, cloud, storage)
+	now := time.Now()
+	im.now = func() time.Time { return now }
+
+	// The sets which fit are added and start the cooldown
+	assert.Equal(t, ErrAttachmentSaturated, im.do(&class))
+	assert.Equal(t, 2, cloud.NumDevices())
+	status, err := im.Status("gp2")
+	assert.NoError(t, err)
+	assert.True(t, status.AttachmentSaturated)
+	assert.Equal(t, now, status.LastScaleUp)
+	assert.NoError(t, im.do(&class))
+}
+
+func TestClassUtilization(t *testing.T) {
+	storage := fake.New(&storageprovider.Topology{
+		Cluster: storageprovider.StorageCluster{
+			StorageNodes: newTestNodes("i-1"),
+		},
+	})
+	ssd := Class{
+		Name:          "ssd",
+		WatermarkHigh: 75,
+		WatermarkLow:  25,
+		DiskSets:      1,
+		DiskSizeGb:    8,
+	}
+	hdd := ssd
+	hdd.Name = "hdd"
+	im := NewManager(&Config{Classes: []Class{ssd, hdd}}, cloudfake.New(), storage)
+
+	// A full ssd tier does not add hdd devices
+	storage.CurrentUtilization = 80
+	storage.CurrentClassUtilization = map[string]int{
+		"ssd": 90,
+		"hdd": 50,
+	}
+	assert.NoError(t, im.do(&hdd))
+	assert.Equal(t, 0, storage.NumDevices())
+	assert.NoError(t, im.do(&ssd))
+	assert.Equal(t, 1, storage.NumDevices())
+
+	// Fall back to the cluster utilization
+	delete(storage.CurrentClassUtilization, "hdd")
+	assert.NoError(t, im.do(&hdd))
+	assert.Equal(t, 2, storage.NumDevices())
+}
+
+func TestCooldownAndStabilization(t *testing.T) {
+	storage := fake.New(&storageprovider.Topology{
+		Cluster: storageprovider.StorageCluster{
+			StorageNodes: newTestNodes("i-1"),
+		},
+	})
+	class := Class{
+		Name:                 "gp2",
+		WatermarkHigh:        75,
+		WatermarkLow:         25,
+		DiskSets:             1,
+		DiskSizeGb:           8,
+		ScaleUpCooldown:      time.Minute,
+		ScaleDownCooldown:    5 * time.Minute,
+		StabilizationSamples: 3,
+	}
+	im := NewManager(&Config{Classes: []Class{class}}, cloudfake.New(), storage)
+	now := time.Now()
+	im.now = func() time.Time { return now }
+
+	// Utilization must stay high for three samples
+	storage.CurrentUtilization = 80
+	for i := 0; i < 2; i++ {
+		assert.NoError(t, im.do(&class))
+		assert.Equal(t, 0, storage.NumDevices())
+	}
+	storage.CurrentUtilization = 50
+	assert.NoError(t, im.do(&class))
+	storage.CurrentUtilization = 80
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, im.do(&class))
+	}
+	assert.Equal(t, 1, storage.NumDevices())
+	status, err := im.Status("gp2")
+	assert.NoError(t, err)
+	assert.Equal(t, now, status.LastScaleUp)
+	assert.True(t, status.LastScaleDown.IsZero())
+
+	// Cooldown after adding storage
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, im.do(&class))
+	}
+	assert.Equal(t, 1, storage.NumDevices())
+	now = now.Add(time.Minute)
+	assert.NoError(t, im.do(&class))
+	assert.Equal(t, 2, storage.NumDevices())
+
+	// Scale down waits for the cooldown since the last scale up
+	storage.CurrentUtilization = 10
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, im.do(&class))
+	}
+	assert.Equal(t, 2, storage.NumDevices())
+	now = now.Add(5 * time.Minute)
+	assert.NoError(t, im.do(&class))
+	assert.Equal(t, 1, storage.NumDevices())
+	status, err = im.Status("gp2")
+	assert.NoError(t, err)
+	assert.Equal(t, now, status.LastScaleDown)
+}
+
+func TestInterval(t *testing.T) {
+	im := NewManager(&Config{}, cloudfake.New(), fake.New(&storageprovider.Topology{}))
+	class := &Class{}
+	assert.Equal(t, time.Second, im.interval(class, 0))
+	assert.Equal(t, 4*time.Second, im.interval(class, 2))
+	assert.Equal(t, 32*time.Second, im.interval(class, 100))
+
+	im.config.Interval = time.Minute
+	assert.Equal(t, time.Minute, im.interval(class, 0))
+
+	class.Interval = 10 * time.Second
+	class.MaxBackoff = 25 * time.Second
+	assert.Equal(t, 20*time.Second, im.interval(class, 1))
+	assert.Equal(t, 25*time.Second, im.interval(class, 2))
+
+	class.Jitter = time.Second
+	for i := 0; i < 10; i++ {
+		interval := im.interval(class, 0)
+		assert.True(t, interval >= 10*time.Second)
+		assert.True(t, interval < 11*time.Second)
+	}
+}
@@ -0,0 +1,169 @@
+/*
+Package inframanager provides an interface to the infrastrcture manager
+Copyright 2018 Portworx
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package inframanager
+
+import (
+	"fmt"
+
+	"go.pedge.io/dlog"
+
+	"github.com/libopenstorage/rico/pkg/storageprovider"
+)
+
+// validateLimits checks that the bounds of the class are consistent
+func (c *Class) validateLimits() error {
+	if c.MinDevices < 0 || c.MaxDevices < 0 || c.MaxDevicesPerNode < 0 {
+		return fmt.Errorf("Device limits of class %s must not be negative", c.Name)
+	}
+	if c.MaxDevices > 0 && c.MinDevices > c.MaxDevices {
+		return fmt.Errorf("MinDevices of class %s is above MaxDevices", c.Name)
+	}
+	if c.MaxCapacityGb > 0 && c.MinCapacityGb > c.MaxCapacityGb {
+		return fmt.Errorf("MinCapacityGb of class %s is above MaxCapacityGb", c.Name)
+	}
+	return nil
+}
+
+// addLimit returns the limit which prevents another disk set from being
+// added to the class, or an empty string if there is none
+func addLimit(t *storageprovider.Topology, class *Class) string {
+	return devicesLimit(t, class, class.DiskSets)
+}
+
+// devicesLimit returns the limit which prevents the number of devices
+// from being added to the class, or an empty string if there is none
+func devicesLimit(t *storageprovider.Topology, class *Class, devices int) string {
+	if class.MaxDevices > 0 &&
+		classDevices(t, class)+devices > class.MaxDevices {
+		return fmt.Sprintf("Class %s is limited to %d devices",
+			class.Name,
+			class.MaxDevices)
+	}
+	size := uint64(devices) * class.DiskSizeGb
+	if class.MaxCapacityGb > 0 &&
+		classCapacity(t, class)+size > class.MaxCapacityGb {
+		return fmt.Sprintf("Class %s is limited to %d GiB",
+			class.Name,
+			class.MaxCapacityGb)
+	}
+	return ""
+}
+
+// removeLimit returns the limit which prevents the device from being
+// removed from the class, or an empty string if there is none
+func removeLimit(
+	t *storageprovider.Topology,
+	class *Class,
+	device *storageprovider.Device,
+) string {
+	if classDevices(t, class)-1 < class.MinDevices {
+		return fmt.Sprintf("Class %s requires at least %d devices",
+			class.Name,
+			class.MinDevices)
+	}
+	if classCapacity(t, class) < class.MinCapacityGb+device.Size {
+		return fmt.Sprintf("Class %s requires at least %d GiB",
+			class.Name,
+			class.MinCapacityGb)
+	}
+	return ""
+}
+
+// stepLimit returns the limit of the class which the step would go past
+// on the topology, or an empty string if there is none
+func stepLimit(t *storageprovider.Topology, class *Class, step *Step) string {
+	node := findNode(t, step.InstanceID)
+	if node == nil {
+		return ""
+	}
+	switch step.Action {
+	case StepCreate:
+		if limit := devicesLimit(t, class, 1); len(limit) != 0 {
+			return limit
+		}
+		if class.MaxDevicesPerNode > 0 &&
+			nodeDevices(node, class)+1 > class.MaxDevicesPerNode {
+			return fmt.Sprintf("Class %s is limited to %d devices per node",
+				class.Name,
+				class.MaxDevicesPerNode)
+		}
+	case StepRemove:
+		if device := findDevice(node, step.DeviceID); device != nil {
+			return removeLimit(t, class, device)
+		}
+	case StepResize:
+		if class.MaxCapacityGb > 0 && step.Size > step.PreviousSize &&
+			classCapacity(t, class)+step.Size-step.PreviousSize > class.MaxCapacityGb {
+			return fmt.Sprintf("Class %s is limited to %d GiB",
+				class.Name,
+				class.MaxCapacityGb)
+		}
+	}
+	return ""
+}
+
+// nodeSlots returns the number of devices of the class each node may
+// still receive, given the attachment capacity of the nodes
+func nodeSlots(
+	t *storageprovider.Topology,
+	class *Class,
+	capacity map[*storageprovider.StorageNode]int,
+) map[*storageprovider.StorageNode]int {
+	slots := make(map[*storageprovider.StorageNode]int)
+	for _, node := range t.Cluster.StorageNodes {
+		c := capacity[node]
+		if class.MaxDevicesPerNode > 0 {
+			remaining := class.MaxDevicesPerNode - nodeDevices(node, class)
+			if remaining < 0 {
+				remaining = 0
+			}
+			if c < 0 || c > remaining {
+				c = remaining
+			}
+		}
+		slots[node] = c
+	}
+	return slots
+}
+
+// blocked records the limit which stopped a plan of the class short
+func blocked(state *classState, limit string) {
+	dlog.Infof("%s", limit)
+	state.status.Limit = limit
+}
+
+// classDevices returns the number of devices of the class
+func classDevices(t *storageprovider.Topology, class *Class) int {
+	devices := 0
+	for _, node := range t.Cluster.StorageNodes {
+		if nodeSupportsClass(node, class) {
+			devices += nodeDevices(node, class)
+		}
+	}
+	return devices
+}
+
+// nodeDevices returns the number of devices of the class on the node
+func nodeDevices(node *storageprovider.StorageNode, class *Class) int {
+	devices := 0
+	for _, device := range node.Devices {
+		if deviceInClass(device, class) {
+			devices++
+		}
+	}
+	return devices
+}
@@ -0,0 +1,131 @@
+/*
+Package inframanager provides an interface to the infrastrcture manager
+Copyright 2018 Portworx
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package inframanager
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	cloudfake "github.com/libopenstorage/rico/pkg/cloudprovider/fake"
+	"github.com/libopenstorage/rico/pkg/storageprovider"
+	"github.com/libopenstorage/rico/pkg/storageprovider/fake"
+)
+
+func TestClassLimits(t *testing.T) {
+	storage := fake.New(&storageprovider.Topology{
+		Cluster: storageprovider.StorageCluster{
+			StorageNodes: newTestNodes("i-1", "i-2"),
+		},
+	})
+	class := Class{
+		Name:          "gp2",
+		WatermarkHigh: 75,
+		WatermarkLow:  25,
+		DiskSets:      2,
+		DiskSizeGb:    8,
+		MinDevices:    1,
+		MaxDevices:    5,
+		MaxCapacityGb: 100,
+	}
+	assert.NoError(t, class.validate())
+	im := NewManager(&Config{Classes: []Class{class}}, cloudfake.New(), storage)
+
+	// Disk sets are only added while they fit
+	storage.CurrentUtilization = 80
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, im.do(&class))
+	}
+	assert.Equal(t, 4, storage.NumDevices())
+	status, err := im.Status("gp2")
+	assert.NoError(t, err)
+	assert.Contains(t, status.Limit, "5 devices")
+
+	class.MaxDevices = 0
+	class.MaxCapacityGb = 40
+	assert.NoError(t, im.do(&class))
+	assert.Equal(t, 4, storage.NumDevices())
+	status, err = im.Status("gp2")
+	assert.NoError(t, err)
+	assert.Contains(t, status.Limit, "40 GiB")
+
+	class.MaxCapacityGb = 0
+	class.MaxDevicesPerNode = 2
+	assert.NoError(t, im.do(&class))
+	assert.Equal(t, 4, storage.NumDevices())
+	status, err = im.Status("gp2")
+	assert.NoError(t, err)
+	assert.Contains(t, status.Limit, "2 devices per node")
+
+	// Scale down stops at the minimum
+	class.ScaleDownSteps = []ScalingStep{{Utilization: 20, Count: 4}}
+	storage.CurrentUtilization = 10
+	assert.NoError(t, im.do(&class))
+	assert.Equal(t, 1, storage.NumDevices())
+	status, err = im.Status("gp2")
+	assert.NoError(t, err)
+	assert.Contains(t, status.Limit, "at least 1 devices")
+
+	// The limits must be consistent
+	class.MinDevices = 6
+	class.MaxDevices = 5
+	assert.Error(t, class.validate())
+	class.MinDevices = 0
+	class.MinCapacityGb = 50
+	class.MaxCapacityGb = 40
+	assert.Error(t, class.validate())
+}
+
+func TestApplyLimits(t *testing.T) {
+	storage := fake.New(&storageprovider.Topology{
+		Cluster: storageprovider.StorageCluster{
+			StorageNodes: newTestNodes("i-1", "i-2"),
+		},
+	})
+	cloud := cloudfake.New()
+	class := Class{
+		Name:          "gp2",
+		WatermarkHigh: 75,
+		WatermarkLow:  25,
+		DiskSets:      2,
+		DiskSizeGb:    8,
+		MaxDevices:    2,
+	}
+	im := NewManager(&Config{Classes: []Class{class}}, cloud, storage)
+	storage.CurrentUtilization = 80
+	plan, err := im.Plan("gp2")
+	assert.NoError(t, err)
+	assert.Len(t, plan.Steps, 6)
+
+	// A plan applied later is refused once it goes past the limits
+	node := storage.Topology.Cluster.StorageNodes[0]
+	assert.NoError(t, storage.DeviceAdd(node, &storageprovider.Device{
+		Size: 8,
+		Metadata: storageprovider.DeviceMetadata{
+			ID:    "vol-x",
+			Class: "gp2",
+		},
+	}))
+	err = im.Apply(plan)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "2 devices")
+	assert.Equal(t, 1, cloud.NumDevices())
+	assert.Equal(t, 2, storage.NumDevices())
+	status, err := im.Status("gp2")
+	assert.NoError(t, err)
+	assert.Contains(t, status.Limit, "2 devices")
+}
@@ -0,0 +1,257 @@
+/*
+Package inframanager provides an interface to the infrastrcture manager
+Copyright 2018 Portworx
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package inframanager
+
+import (
+	"fmt"
+
+	"go.pedge.io/dlog"
+
+	"github.com/libopenstorage/rico/pkg/storageprovider"
+)
+
+// NodeLeavePolicy decides what happens to the cloud devices of a node
+// which left the storage system
+type NodeLeavePolicy string
+
+const (
+	// NodeLeaveOrphan keeps the devices and reports them as orphans so
+	// they can be adopted. This is the default.
+	NodeLeaveOrphan NodeLeavePolicy = ""
+
+	// NodeLeaveDelete detaches and deletes the devices
+	NodeLeaveDelete NodeLeavePolicy = "delete"
+)
+
+// validateNodes checks the node join and leave settings of the class
+func (c *Class) validateNodes() error {
+	if c.NodeBaseline < 0 {
+		return fmt.Errorf("NodeBaseline of class %s must not be negative", c.Name)
+	}
+	switch c.NodeLeave {
+	case NodeLeaveOrphan, NodeLeaveDelete:
+	default:
+		return fmt.Errorf("Unknown node leave policy %s for class %s", c.NodeLeave, c.Name)
+	}
+	return nil
+}
+
+// reconcileNodes handles the nodes which joined or left the storage
+// system since the last check of the class. Nodes seen on the first
+// check are not considered new.
+func (m *Manager) reconcileNodes(class *Class, state *classState, utilization int) error {
+	t, err := m.storage.GetTopology()
+	if err != nil {
+		return fmt.Errorf("Failed to get topology: %v", err)
+	}
+	if state.nodes == nil {
+		state.nodes = make(map[string][]*storageprovider.Device)
+		for _, node := range t.Cluster.StorageNodes {
+			state.nodes[node.Metadata.ID] = classDeviceList(node, class)
+		}
+		return nil
+	}
+
+	// Nodes which left
+	present := make(map[string]bool)
+	for _, node := range t.Cluster.StorageNodes {
+		present[node.Metadata.ID] = true
+	}
+	for id, devices := range state.nodes {
+		if !present[id] {
+			dlog.Infof("Node %s left the storage system", id)
+			m.nodeLeft(class, id, devices)
+			delete(state.nodes, id)
+		}
+	}
+
+	// Nodes which joined. They are only recorded once they have their
+	// baseline, so a rejected or expired plan is planned again later.
+	joined := make([]*storageprovider.StorageNode, 0)
+	for _, node := range t.Cluster.StorageNodes {
+		if _, ok := state.nodes[node.Metadata.ID]; ok {
+			state.nodes[node.Metadata.ID] = classDeviceList(node, class)
+			continue
+		}
+		joined = append(joined, node)
+	}
+	if len(joined) == 0 {
+		return nil
+	}
+	plan, err := m.planBaseline(class, state, utilization, joined)
+	if err != nil {
+		return err
+	}
+	if len(plan.Steps) != 0 {
+		if needsApproval(class, plan) {
+			if (state.pending == nil || m.expired(state)) && !m.rejected(state) {
+				m.queue(class, state, plan)
+			}
+			// Retry once the pending plan is done
+			return nil
+		}
+		if _, err := m.apply(class, state, plan); err != nil {
+			return err
+		}
+	}
+	for _, node := range joined {
+		dlog.Infof("Node %s joined the storage system", node.Metadata.ID)
+		state.nodes[node.Metadata.ID] = classDeviceList(node, class)
+	}
+	return nil
+}
+
+// planBaseline returns a plan which gives the new nodes the baseline
+// number of devices of the class
+func (m *Manager) planBaseline(
+	class *Class,
+	state *classState,
+	utilization int,
+	joined []*storageprovider.StorageNode,
+) (*Plan, error) {
+	plan := m.newPlan(class, utilization)
+	if class.NodeBaseline == 0 {
+		return plan, nil
+	}
+	t, err := m.topology()
+	if err != nil {
+		return nil, err
+	}
+
+	// Only consider the new nodes which support the class
+	nodes := make([]*storageprovider.StorageNode, 0, len(joined))
+	for _, node := range t.Cluster.StorageNodes {
+		for _, j := range joined {
+			if node.Metadata.ID == j.Metadata.ID &&
+				nodeSupportsClass(node, class) &&
+				class.NodeAllowed(node) {
+				nodes = append(nodes, node)
+			}
+		}
+	}
+	eligible := &storageprovider.Topology{
+		Cluster: storageprovider.StorageCluster{
+			StorageNodes: nodes,
+		},
+	}
+	capacity, err := m.attachmentCapacity(eligible)
+	if err != nil {
+		return nil, err
+	}
+	slots := nodeSlots(eligible, class, capacity)
+
+	device := 0
+	for _, node := range nodes {
+		reason := fmt.Sprintf("node %s joined with %d of %d baseline devices",
+			node.Metadata.ID,
+			nodeDevices(node, class),
+			class.NodeBaseline)
+		for nodeDevices(node, class) < class.NodeBaseline {
+			if limit := devicesLimit(t, class, 1); len(limit) != 0 {
+				blocked(state, limit)
+				return plan, nil
+			}
+			if slots[node] == 0 {
+				if class.MaxDevicesPerNode > 0 &&
+					nodeDevices(node, class) >= class.MaxDevicesPerNode {
+					blocked(state, fmt.Sprintf("Class %s is limited to %d devices per node",
+						class.Name,
+						class.MaxDevicesPerNode))
+				}
+				break
+			}
+
+			device++
+			for _, action := range []StepAction{StepCreate, StepAttach, StepAdd} {
+				plan.Steps = append(plan.Steps, &Step{
+					Action:     action,
+					InstanceID: node.Metadata.ID,
+					Device:     device,
+					Size:       class.DiskSizeGb,
+					Parameters: class.Parameters,
+					Reason:     reason,
+				})
+			}
+
+			// Account for the device in the limits of the next ones
+			node.Devices = append(node.Devices, &storageprovider.Device{
+				Size: class.DiskSizeGb,
+				Metadata: storageprovider.DeviceMetadata{
+					Class: class.Name,
+				},
+			})
+			if slots[node] > 0 {
+				slots[node]--
+			}
+		}
+	}
+	return plan, nil
+}
+
+// nodeLeft deletes or orphans the cloud devices of a node which left the
+// storage system, according to the policy of the class
+func (m *Manager) nodeLeft(class *Class, instanceID string, devices []*storageprovider.Device) {
+	for _, device := range devices {
+		id := device.Metadata.ID
+		if len(id) == 0 || !m.ownsDevice(class, device) {
+			continue
+		}
+		if class.NodeLeave != NodeLeaveDelete {
+			// Also keeps devices the garbage collector already found
+			m.addOrphan(instanceID, id,
+				fmt.Sprintf("Node %s left the storage system", instanceID),
+				true)
+			continue
+		}
+		if m.isOrphan(id) {
+			continue
+		}
+		if err := m.cloud.DeviceDelete(instanceID, id); err != nil {
+			m.addOrphan(instanceID, id,
+				fmt.Sprintf("Failed to delete device of node %s which left: %v",
+					instanceID,
+					err),
+				false)
+			continue
+		}
+		dlog.Infof("Deleted device %s of node %s which left", id, instanceID)
+	}
+}
+
+// ownsDevice returns true if the class decides what happens to the
+// device when its node leaves. Devices with no class are part of every
+// class, so they belong to the first configured class.
+func (m *Manager) ownsDevice(class *Class, device *storageprovider.Device) bool {
+	if len(device.Metadata.Class) != 0 {
+		return device.Metadata.Class == class.Name
+	}
+	return len(m.config.Classes) != 0 && m.config.Classes[0].Name == class.Name
+}
+
+// classDeviceList returns the devices of the class on the node
+func classDeviceList(
+	node *storageprovider.StorageNode,
+	class *Class,
+) []*storageprovider.Device {
+	devices := make([]*storageprovider.Device, 0, len(node.Devices))
+	for _, device := range node.Devices {
+		if deviceInClass(device, class) {
+			devices = append(devices, device)
+		}
+	}
+	return devices
+}
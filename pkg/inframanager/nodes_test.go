@@ -0,0 +1,279 @@
+/*
+Package inframanager provides an interface to the infrastrcture manager
+Copyright 2018 Portworx
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package inframanager
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/libopenstorage/rico/pkg/cloudprovider"
+	cloudfake "github.com/libopenstorage/rico/pkg/cloudprovider/fake"
+	"github.com/libopenstorage/rico/pkg/storageprovider"
+	"github.com/libopenstorage/rico/pkg/storageprovider/fake"
+)
+
+func TestNodeJoinLeave(t *testing.T) {
+	storage := fake.New(&storageprovider.Topology{
+		Cluster: storageprovider.StorageCluster{
+			StorageNodes: newTestNodes("i-1"),
+		},
+	})
+	cloud := cloudfake.New()
+	class := Class{
+		Name:          "gp2",
+		WatermarkHigh: 75,
+		WatermarkLow:  25,
+		DiskSets:      1,
+		DiskSizeGb:    8,
+		NodeBaseline:  2,
+	}
+	assert.NoError(t, class.validate())
+	im := NewManager(&Config{Classes: []Class{class}}, cloud, storage)
+
+	// Existing nodes are not new
+	assert.NoError(t, im.do(&class))
+	assert.Equal(t, 0, storage.NumDevices())
+
+	// New nodes receive the baseline
+	cluster := &storage.Topology.Cluster
+	cluster.StorageNodes = append(cluster.StorageNodes, newTestNodes("i-2")...)
+	assert.NoError(t, im.do(&class))
+	assert.Len(t, cluster.StorageNodes[0].Devices, 0)
+	assert.Len(t, cluster.StorageNodes[1].Devices, 2)
+	assert.Equal(t, 2, cloud.NumDevices())
+
+	// The devices of nodes which left are orphaned
+	cluster.StorageNodes = cluster.StorageNodes[:1]
+	assert.NoError(t, im.do(&class))
+	orphans := im.Orphans()
+	assert.Len(t, orphans, 2)
+	assert.Equal(t, "i-2", orphans[0].InstanceID)
+	assert.Contains(t, orphans[0].Reason, "left")
+	assert.Equal(t, 2, cloud.NumDevices())
+	assert.NoError(t, im.Adopt(orphans[0].DeviceID))
+	assert.Len(t, im.Orphans(), 1)
+	assert.Error(t, im.Adopt(orphans[0].DeviceID))
+
+	// Or deleted
+	class.NodeLeave = NodeLeaveDelete
+	cluster.StorageNodes = append(cluster.StorageNodes, newTestNodes("i-3")...)
+	assert.NoError(t, im.do(&class))
+	assert.Equal(t, 4, cloud.NumDevices())
+	cluster.StorageNodes = cluster.StorageNodes[:1]
+	assert.NoError(t, im.do(&class))
+	assert.Equal(t, 2, cloud.NumDevices())
+	assert.Len(t, im.Orphans(), 1)
+
+	class.NodeLeave = "unknown"
+	assert.Error(t, class.validate())
+}
+
+func TestNodeBaselineLimits(t *testing.T) {
+	storage := fake.New(&storageprovider.Topology{
+		Cluster: storageprovider.StorageCluster{
+			StorageNodes: newTestNodes("i-1"),
+		},
+	})
+	cloud := cloudfake.New()
+	class := Class{
+		Name:              "gp2",
+		WatermarkHigh:     75,
+		WatermarkLow:      25,
+		DiskSets:          1,
+		DiskSizeGb:        8,
+		NodeBaseline:      2,
+		MaxDevices:        2,
+		MaxDevicesPerNode: 1,
+	}
+	assert.NoError(t, class.validate())
+	im := NewManager(&Config{Classes: []Class{class}}, cloud, storage)
+	assert.NoError(t, im.do(&class))
+
+	// Nodes joining together share the limits of the class
+	cluster := &storage.Topology.Cluster
+	cluster.StorageNodes = append(cluster.StorageNodes, newTestNodes("i-2", "i-3")...)
+	assert.NoError(t, im.do(&class))
+	assert.Len(t, cluster.StorageNodes[1].Devices, 1)
+	assert.Len(t, cluster.StorageNodes[2].Devices, 1)
+	assert.Equal(t, 2, cloud.NumDevices())
+	status, err := im.Status("gp2")
+	assert.NoError(t, err)
+	assert.Contains(t, status.Limit, "limited to")
+}
+
+func TestNodeBaselineApproval(t *testing.T) {
+	storage := fake.New(&storageprovider.Topology{
+		Cluster: storageprovider.StorageCluster{
+			StorageNodes: newTestNodes("i-1"),
+		},
+	})
+	class := Class{
+		Name:          "gp2",
+		WatermarkHigh: 75,
+		WatermarkLow:  25,
+		DiskSets:      1,
+		DiskSizeGb:    8,
+		NodeBaseline:  1,
+		Approval: ApprovalConfig{
+			Required:       true,
+			Timeout:        time.Hour,
+			RejectCooldown: time.Minute,
+		},
+	}
+	im := NewManager(&Config{Classes: []Class{class}}, cloudfake.New(), storage)
+	now := time.Now()
+	im.now = func() time.Time { return now }
+	assert.NoError(t, im.do(&class))
+
+	// The baseline is planned again after the rejection cooldown
+	cluster := &storage.Topology.Cluster
+	cluster.StorageNodes = append(cluster.StorageNodes, newTestNodes("i-2")...)
+	assert.NoError(t, im.do(&class))
+	assert.NoError(t, im.do(&class))
+	pending := im.PendingPlans()
+	assert.Len(t, pending, 1)
+	assert.NoError(t, im.Reject(pending[0].Plan.ID, "not now"))
+	assert.NoError(t, im.do(&class))
+	assert.Len(t, im.PendingPlans(), 0)
+	now = now.Add(class.Approval.RejectCooldown)
+	assert.NoError(t, im.do(&class))
+	pending = im.PendingPlans()
+	assert.Len(t, pending, 1)
+
+	// And after it expired
+	now = now.Add(2 * time.Hour)
+	assert.NoError(t, im.do(&class))
+	assert.Len(t, im.PendingPlans(), 1)
+	assert.NotEqual(t, pending[0].Plan.ID, im.PendingPlans()[0].Plan.ID)
+
+	// The node is done once the plan is applied
+	assert.NoError(t, im.Approve(im.PendingPlans()[0].Plan.ID))
+	assert.Len(t, cluster.StorageNodes[1].Devices, 1)
+	assert.NoError(t, im.do(&class))
+	assert.Len(t, im.PendingPlans(), 0)
+	assert.Len(t, cluster.StorageNodes[1].Devices, 1)
+}
+
+func TestNodeBaselineFailure(t *testing.T) {
+	storage := fake.New(&storageprovider.Topology{
+		Cluster: storageprovider.StorageCluster{
+			StorageNodes: newTestNodes("i-1"),
+		},
+	})
+	cloud := cloudfake.New()
+	class := Class{
+		Name:          "gp2",
+		WatermarkHigh: 75,
+		WatermarkLow:  25,
+		DiskSets:      1,
+		DiskSizeGb:    8,
+		NodeBaseline:  2,
+	}
+	im := NewManager(&Config{Classes: []Class{class}}, cloud, storage)
+	assert.NoError(t, im.do(&class))
+
+	// The class still scales up when the baseline of a new node fails
+	nodes := newTestNodes("i-2")
+	nodes[0].Devices = []*storageprovider.Device{
+		{Size: 8, Metadata: storageprovider.DeviceMetadata{ID: "vol-x"}},
+	}
+	cluster := &storage.Topology.Cluster
+	cluster.StorageNodes = append(cluster.StorageNodes, nodes...)
+	cloud.CreateErrors = map[string]error{"i-2": fmt.Errorf("quota exceeded")}
+	storage.CurrentUtilization = 95
+	assert.NoError(t, im.do(&class))
+	assert.Len(t, cluster.StorageNodes[0].Devices, 1)
+	assert.Len(t, cluster.StorageNodes[1].Devices, 1)
+
+	// And gives the baseline once the node can get devices
+	cloud.CreateErrors = nil
+	storage.CurrentUtilization = 50
+	assert.NoError(t, im.do(&class))
+	assert.Len(t, cluster.StorageNodes[1].Devices, 2)
+}
+
+func TestNodeNoBaseline(t *testing.T) {
+	storage := fake.New(&storageprovider.Topology{
+		Cluster: storageprovider.StorageCluster{
+			StorageNodes: newTestNodes("i-1"),
+		},
+	})
+	cloud := cloudfake.New()
+	class := Class{
+		Name:          "gp2",
+		WatermarkHigh: 75,
+		WatermarkLow:  25,
+		DiskSets:      1,
+		DiskSizeGb:    8,
+	}
+	im := NewManager(&Config{Classes: []Class{class}}, cloud, storage)
+	assert.NoError(t, im.do(&class))
+
+	// Nodes joining a class without a baseline only need to be recorded
+	cluster := &storage.Topology.Cluster
+	cluster.StorageNodes = append(cluster.StorageNodes, newTestNodes("i-2")...)
+	assert.NoError(t, im.do(&class))
+	assert.Len(t, im.state(&class).nodes, 2)
+	assert.Equal(t, 0, cloud.NumDevices())
+}
+
+func TestNodeLeaveUnclassified(t *testing.T) {
+	cloud := cloudfake.New()
+	d, err := cloud.DeviceCreate("i-2", &cloudprovider.DeviceSpecs{Size: 8})
+	assert.NoError(t, err)
+	nodes := newTestNodes("i-1", "i-2")
+	nodes[1].Devices = []*storageprovider.Device{
+		{Size: 8, Metadata: storageprovider.DeviceMetadata{ID: d.ID}},
+	}
+	storage := fake.New(&storageprovider.Topology{
+		Cluster: storageprovider.StorageCluster{
+			StorageNodes: nodes,
+		},
+	})
+	classes := []Class{
+		{
+			Name:          "gp2",
+			WatermarkHigh: 75,
+			WatermarkLow:  25,
+			DiskSets:      1,
+			DiskSizeGb:    8,
+			NodeLeave:     NodeLeaveDelete,
+		},
+		{
+			Name:          "io1",
+			WatermarkHigh: 75,
+			WatermarkLow:  25,
+			DiskSets:      1,
+			DiskSizeGb:    8,
+			NodeLeave:     NodeLeaveDelete,
+		},
+	}
+	im := NewManager(&Config{Classes: classes}, cloud, storage)
+	assert.NoError(t, im.do(&classes[1]))
+	assert.NoError(t, im.do(&classes[0]))
+
+	// Devices with no class are only handled by the first class
+	storage.Topology.Cluster.StorageNodes = nodes[:1]
+	assert.NoError(t, im.do(&classes[1]))
+	assert.Equal(t, 1, cloud.NumDevices())
+	assert.NoError(t, im.do(&classes[0]))
+	assert.Equal(t, 0, cloud.NumDevices())
+	assert.Len(t, im.Orphans(), 0)
+}
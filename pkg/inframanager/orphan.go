@@ -0,0 +1,128 @@
+/*
+Package inframanager provides an interface to the infrastrcture manager
+Copyright 2018 Portworx
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package inframanager
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"go.pedge.io/dlog"
+)
+
+// Orphan is a cloud device which is not used by the storage system and
+// needs to be adopted or cleaned up
+type Orphan struct {
+	DeviceID   string
+	InstanceID string
+
+	// Reason the device was orphaned
+	Reason string
+
+	// Detected is when the device was found to be orphaned
+	Detected time.Time
+
+	// Adopt is true if the device is kept until it is adopted instead
+	// of being deleted by the garbage collector
+	Adopt bool
+}
+
+// Orphans returns the orphaned cloud devices, oldest first
+func (m *Manager) Orphans() []*Orphan {
+	m.orphansLock.Lock()
+	defer m.orphansLock.Unlock()
+
+	orphans := make([]*Orphan, 0, len(m.orphans))
+	for _, orphan := range m.orphans {
+		o := *orphan
+		orphans = append(orphans, &o)
+	}
+	sort.Slice(orphans, func(i, j int) bool {
+		if !orphans[i].Detected.Equal(orphans[j].Detected) {
+			return orphans[i].Detected.Before(orphans[j].Detected)
+		}
+		return orphans[i].DeviceID < orphans[j].DeviceID
+	})
+	return orphans
+}
+
+// Adopt removes the device from the orphans once it has been taken
+// over or cleaned up outside of the manager
+func (m *Manager) Adopt(deviceID string) error {
+	m.orphansLock.Lock()
+	defer m.orphansLock.Unlock()
+
+	if _, ok := m.orphans[deviceID]; !ok {
+		return fmt.Errorf("Device %s is not an orphan", deviceID)
+	}
+	delete(m.orphans, deviceID)
+	dlog.Infof("Device %s adopted", deviceID)
+	return nil
+}
+
+// addOrphan records the device as orphaned unless it already is. An
+// existing orphan is kept for adoption if adopt is set.
+func (m *Manager) addOrphan(instanceID, deviceID, reason string, adopt bool) {
+	m.orphansLock.Lock()
+	defer m.orphansLock.Unlock()
+
+	if orphan, ok := m.orphans[deviceID]; ok {
+		if adopt && !orphan.Adopt {
+			orphan.Adopt = true
+			orphan.Reason = reason
+			dlog.Infof("Orphaned device %s on instance %s is kept for adoption: %s",
+				deviceID,
+				instanceID,
+				reason)
+		}
+		return
+	}
+	m.orphans[deviceID] = &Orphan{
+		DeviceID:   deviceID,
+		InstanceID: instanceID,
+		Reason:     reason,
+		Detected:   m.now(),
+		Adopt:      adopt,
+	}
+	dlog.Errorf("Device %s on instance %s is orphaned: %s", deviceID, instanceID, reason)
+}
+
+// isOrphan returns true if the device is a known orphan
+func (m *Manager) isOrphan(deviceID string) bool {
+	return m.orphan(deviceID) != nil
+}
+
+// orphan returns a copy of the orphan or nil if the device is not one
+func (m *Manager) orphan(deviceID string) *Orphan {
+	m.orphansLock.Lock()
+	defer m.orphansLock.Unlock()
+
+	orphan, ok := m.orphans[deviceID]
+	if !ok {
+		return nil
+	}
+	o := *orphan
+	return &o
+}
+
+// dropOrphan forgets the orphaned device
+func (m *Manager) dropOrphan(deviceID string) {
+	m.orphansLock.Lock()
+	defer m.orphansLock.Unlock()
+
+	delete(m.orphans, deviceID)
+}
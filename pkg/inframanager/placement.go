@@ -0,0 +1,381 @@
+/*
+Package inframanager provides an interface to the infrastrcture manager
+Copyright 2018 Portworx
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package inframanager
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/libopenstorage/rico/pkg/storageprovider"
+)
+
+const (
+	// PlacementLeastDevices places each device of a disk set on the
+	// storage node with the fewest devices. This is the default.
+	PlacementLeastDevices = "leastdevices"
+
+	// PlacementLeastCapacity places each device of a disk set on the
+	// storage node with the fewest provisioned GiB
+	PlacementLeastCapacity = "leastcapacity"
+
+	// PlacementLeastFree places each device of a disk set on the storage
+	// node with the fewest unused GiB, evening out free space across nodes
+	PlacementLeastFree = "leastfree"
+)
+
+// SpreadPolicy determines how the devices of a disk set are spread
+// across failure domains
+type SpreadPolicy string
+
+const (
+	// SpreadNone does not take failure domains into account
+	SpreadNone SpreadPolicy = ""
+
+	// SpreadPreferred places each device of a disk set in a different
+	// failure domain when possible. If there are not enough domains,
+	// devices are placed in the domains with the fewest devices of the set.
+	SpreadPreferred SpreadPolicy = "preferred"
+
+	// SpreadRequired places each device of a disk set in a different
+	// failure domain and refuses to add storage if there are not enough
+	// domains.
+	SpreadRequired SpreadPolicy = "required"
+)
+
+// Placement is the interface to an algorithm which decides where new
+// devices are attached
+type Placement interface {
+	// Place returns the storage nodes which will receive the next disk
+	// set of the class. One node must be returned for each device in the
+	// set, and the same node may be returned more than once.
+	Place(t *storageprovider.Topology, class *Class) ([]*storageprovider.StorageNode, error)
+}
+
+var (
+	placementsLock sync.Mutex
+	placements     = map[string]Placement{
+		PlacementLeastDevices: nodeLess(func(
+			class *Class,
+			a, b *storageprovider.StorageNode,
+			pending PendingDevices,
+		) bool {
+			return len(a.Devices)+pending[a] < len(b.Devices)+pending[b]
+		}),
+		PlacementLeastCapacity: nodeLess(func(
+			class *Class,
+			a, b *storageprovider.StorageNode,
+			pending PendingDevices,
+		) bool {
+			return nodeCapacity(a)+pending.size(a, class) <
+				nodeCapacity(b)+pending.size(b, class)
+		}),
+		PlacementScheduler: &scheduler{},
+		PlacementLeastFree: nodeLess(func(
+			class *Class,
+			a, b *storageprovider.StorageNode,
+			pending PendingDevices,
+		) bool {
+			return nodeFree(a)+pending.size(a, class) <
+				nodeFree(b)+pending.size(b, class)
+		}),
+	}
+)
+
+// RegisterPlacement registers a placement algorithm which can then be
+// selected by setting Class.Placement to its name
+func RegisterPlacement(name string, p Placement) error {
+	placementsLock.Lock()
+	defer placementsLock.Unlock()
+
+	if len(name) == 0 {
+		return fmt.Errorf("Placement name must not be empty")
+	}
+	if p == nil {
+		return fmt.Errorf("Placement %s is nil", name)
+	}
+	if _, ok := placements[name]; ok {
+		return fmt.Errorf("Placement %s already registered", name)
+	}
+	placements[name] = p
+	return nil
+}
+
+// getPlacement returns the placement algorithm for the class
+func getPlacement(class *Class) (Placement, error) {
+	placementsLock.Lock()
+	defer placementsLock.Unlock()
+
+	name := class.Placement
+	if len(name) == 0 {
+		name = PlacementLeastDevices
+	}
+	p, ok := placements[name]
+	if !ok {
+		return nil, fmt.Errorf("Unknown placement %s for class %s", name, class.Name)
+	}
+	return p, nil
+}
+
+// PendingDevices is the number of devices already picked for each node
+type PendingDevices map[*storageprovider.StorageNode]int
+
+// size returns the GiB already picked for the node
+func (p PendingDevices) size(node *storageprovider.StorageNode, class *Class) uint64 {
+	return uint64(p[node]) * class.DiskSizeGb
+}
+
+// nodeLess is a placement algorithm which compares nodes. It returns true
+// if node a is a better candidate than node b. Nodes preferred by the
+// affinity rules of the class are always considered better.
+type nodeLess func(class *Class, a, b *storageprovider.StorageNode, pending PendingDevices) bool
+
+func (less nodeLess) Place(
+	t *storageprovider.Topology,
+	class *Class,
+) ([]*storageprovider.StorageNode, error) {
+	return pickNodes(t, class, func(
+		candidates []*storageprovider.StorageNode,
+		pending PendingDevices,
+	) nodeCompare {
+		return func(a, b *storageprovider.StorageNode) bool {
+			// Nodes preferred by the affinity rules come first
+			if scoreA, scoreB := class.AffinityScore(a),
+				class.AffinityScore(b); scoreA != scoreB {
+				return scoreA > scoreB
+			}
+			return less(class, a, b, pending)
+		}
+	})
+}
+
+// nodeCompare returns true if node a is a better candidate than node b
+type nodeCompare func(a, b *storageprovider.StorageNode) bool
+
+// nodeRanking returns how to compare the candidates for the next device
+// of a disk set, given the devices already picked for the set
+type nodeRanking func(
+	candidates []*storageprovider.StorageNode,
+	pending PendingDevices,
+) nodeCompare
+
+// pickNodes chooses a node for each device of a disk set. Candidates are
+// compared according to rank, which is given the number of devices
+// already picked for each node in this set. When the class requests it,
+// each device is placed in the failure domain which has received the
+// fewest devices of the set.
+func pickNodes(
+	t *storageprovider.Topology,
+	class *Class,
+	rank nodeRanking,
+) ([]*storageprovider.StorageNode, error) {
+	if len(t.Cluster.StorageNodes) == 0 {
+		return nil, fmt.Errorf("Cluster has no storage nodes")
+	}
+	candidates, err := spreadCandidates(t.Cluster.StorageNodes, class, rank)
+	if err != nil {
+		return nil, err
+	}
+
+	level := class.spreadLevel()
+	pending := make(PendingDevices)
+	domains := make(map[string]int)
+	nodes := make([]*storageprovider.StorageNode, 0, class.DiskSets)
+	for set := 0; set < class.DiskSets; set++ {
+		less := rank(candidates, pending)
+		var node *storageprovider.StorageNode
+		for _, currentNode := range candidates {
+			if node == nil {
+				node = currentNode
+				continue
+			}
+			if class.Spread != SpreadNone {
+				// Prefer the domain with the fewest devices of this set
+				current := domains[currentNode.Metadata.FailureDomain(level)]
+				picked := domains[node.Metadata.FailureDomain(level)]
+				if current != picked {
+					if current < picked {
+						node = currentNode
+					}
+					continue
+				}
+			}
+			if less(currentNode, node) {
+				node = currentNode
+			}
+		}
+		pending[node]++
+		domains[node.Metadata.FailureDomain(level)]++
+		nodes = append(nodes, node)
+	}
+
+	return nodes, nil
+}
+
+// spreadCandidates returns the nodes a disk set may be placed on. If the
+// class confines its disk sets to a single failure domain, the domain
+// with the most room to spread the set is returned. An error is returned
+// if the spread of the class is required but cannot be honored.
+func spreadCandidates(
+	nodes []*storageprovider.StorageNode,
+	class *Class,
+	rank nodeRanking,
+) ([]*storageprovider.StorageNode, error) {
+	level := class.spreadLevel()
+	if len(class.SpreadWithin) == 0 {
+		if err := checkDomains(nodes, class); err != nil {
+			return nil, err
+		}
+		return nodes, nil
+	}
+
+	// Group the nodes by their parent domain
+	groups := make(map[string][]*storageprovider.StorageNode)
+	order := make([]string, 0)
+	for _, node := range nodes {
+		parent := node.Metadata.FailureDomain(class.SpreadWithin)
+		if _, ok := groups[parent]; !ok {
+			order = append(order, parent)
+		}
+		groups[parent] = append(groups[parent], node)
+	}
+
+	less := rank(nodes, PendingDevices{})
+	var (
+		best        []*storageprovider.StorageNode
+		bestDomains int
+		bestNode    *storageprovider.StorageNode
+	)
+	for _, parent := range order {
+		group := groups[parent]
+		n := numDomains(group, level)
+		if n > class.DiskSets {
+			n = class.DiskSets
+		}
+		if class.Spread == SpreadRequired && n < class.DiskSets {
+			continue
+		}
+
+		// Pick the group with the most domains, then the group with
+		// the best node
+		groupNode := group[0]
+		for _, node := range group {
+			if less(node, groupNode) {
+				groupNode = node
+			}
+		}
+		if best == nil ||
+			n > bestDomains ||
+			(n == bestDomains && less(groupNode, bestNode)) {
+			best = group
+			bestDomains = n
+			bestNode = groupNode
+		}
+	}
+	if best == nil {
+		return nil, fmt.Errorf("Class %s requires %d %s failure domains within "+
+			"a single %s but none are available",
+			class.Name,
+			class.DiskSets,
+			level,
+			class.SpreadWithin)
+	}
+
+	return best, nil
+}
+
+// numDomains returns the number of failure domains at the level which
+// contain the nodes
+func numDomains(nodes []*storageprovider.StorageNode, level storageprovider.FailureDomainLevel) int {
+	domains := make(map[string]bool)
+	for _, node := range nodes {
+		domains[node.Metadata.FailureDomain(level)] = true
+	}
+	return len(domains)
+}
+
+// checkDomains returns an error if the class requires its disk sets to be
+// spread across failure domains but there are not enough available
+func checkDomains(nodes []*storageprovider.StorageNode, class *Class) error {
+	if class.Spread != SpreadRequired {
+		return nil
+	}
+
+	level := class.spreadLevel()
+	if n := numDomains(nodes, level); n < class.DiskSets {
+		return fmt.Errorf("Class %s requires %d %s failure domains but only %d are available",
+			class.Name,
+			class.DiskSets,
+			level,
+			n)
+	}
+	return nil
+}
+
+// checkSpread returns an error if the nodes chosen for a disk set do not
+// honor the spread policy of the class
+func checkSpread(nodes []*storageprovider.StorageNode, class *Class) error {
+	if len(class.SpreadWithin) != 0 && len(nodes) != 0 {
+		parent := nodes[0].Metadata.FailureDomain(class.SpreadWithin)
+		for _, node := range nodes {
+			if node.Metadata.FailureDomain(class.SpreadWithin) != parent {
+				return fmt.Errorf("Class %s requires each disk set within a single %s "+
+					"but %s and %s were picked",
+					class.Name,
+					class.SpreadWithin,
+					parent,
+					node.Metadata.FailureDomain(class.SpreadWithin))
+			}
+		}
+	}
+
+	if class.Spread != SpreadRequired {
+		return nil
+	}
+
+	level := class.spreadLevel()
+	domains := make(map[string]bool)
+	for _, node := range nodes {
+		domain := node.Metadata.FailureDomain(level)
+		if domains[domain] {
+			return fmt.Errorf("Class %s requires a separate %s for each device "+
+				"but %s was picked more than once",
+				class.Name,
+				level,
+				domain)
+		}
+		domains[domain] = true
+	}
+	return nil
+}
+
+// nodeCapacity returns the total size in GiB of the devices on the node
+func nodeCapacity(node *storageprovider.StorageNode) uint64 {
+	var size uint64
+	for _, device := range node.Devices {
+		size += device.Size
+	}
+	return size
+}
+
+// nodeFree returns the unused GiB of the devices on the node
+func nodeFree(node *storageprovider.StorageNode) uint64 {
+	var free uint64
+	for _, device := range node.Devices {
+		free += device.Size * uint64(100-device.Utilization) / 100
+	}
+	return free
+}
@@ -0,0 +1,240 @@
+/*
+Package inframanager provides an interface to the infrastrcture manager
+Copyright 2018 Portworx
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package inframanager
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	cloudfake "github.com/libopenstorage/rico/pkg/cloudprovider/fake"
+	"github.com/libopenstorage/rico/pkg/storageprovider"
+	"github.com/libopenstorage/rico/pkg/storageprovider/fake"
+)
+
+type firstNode struct{}
+
+func (f *firstNode) Place(
+	t *storageprovider.Topology,
+	class *Class,
+) ([]*storageprovider.StorageNode, error) {
+	nodes := make([]*storageprovider.StorageNode, class.DiskSets)
+	for i := range nodes {
+		nodes[i] = t.Cluster.StorageNodes[0]
+	}
+	return nodes, nil
+}
+
+func TestLeastDevicesPlacement(t *testing.T) {
+	nodes := newTestNodes("i-1", "i-2", "i-3")
+	nodes[0].Devices = []*storageprovider.Device{{}, {}}
+	nodes[2].Devices = []*storageprovider.Device{{}}
+	topology := &storageprovider.Topology{
+		Cluster: storageprovider.StorageCluster{
+			StorageNodes: nodes,
+		},
+	}
+
+	p, err := getPlacement(&Class{})
+	assert.NoError(t, err)
+
+	picked, err := p.Place(topology, &Class{DiskSets: 3})
+	assert.NoError(t, err)
+	assert.Equal(t, []*storageprovider.StorageNode{
+		nodes[1], nodes[1], nodes[2],
+	}, picked)
+}
+
+func TestRegisterPlacement(t *testing.T) {
+	assert.NoError(t, RegisterPlacement("test-firstnode", &firstNode{}))
+	defer func() {
+		placementsLock.Lock()
+		defer placementsLock.Unlock()
+		delete(placements, "test-firstnode")
+	}()
+	assert.Error(t, RegisterPlacement("test-firstnode", &firstNode{}))
+	assert.Error(t, RegisterPlacement("", &firstNode{}))
+
+	storage := fake.New(&storageprovider.Topology{
+		Cluster: storageprovider.StorageCluster{
+			StorageNodes: newTestNodes("i-1", "i-2"),
+		},
+	})
+	class := Class{
+		Name:          "gp2",
+		WatermarkHigh: 75,
+		DiskSets:      2,
+		DiskSizeGb:    8,
+		Placement:     "test-firstnode",
+	}
+	im := NewManager(&Config{Classes: []Class{class}}, cloudfake.New(), storage)
+
+	storage.CurrentUtilization = 80
+	assert.NoError(t, im.do(&class))
+	assert.Len(t, storage.Topology.Cluster.StorageNodes[0].Devices, 2)
+	assert.Len(t, storage.Topology.Cluster.StorageNodes[1].Devices, 0)
+
+	class.Placement = "unknown"
+	assert.Error(t, im.do(&class))
+}
+
+func TestZoneSpreadPlacement(t *testing.T) {
+	nodes := newTestNodes("i-1", "i-2", "i-3", "i-4")
+	nodes[0].Metadata.Zone = "us-east-1a"
+	nodes[1].Metadata.Zone = "us-east-1a"
+	nodes[2].Metadata.Zone = "us-east-1b"
+	nodes[3].Metadata.Zone = "us-east-1b"
+	nodes[0].Devices = []*storageprovider.Device{{}}
+	nodes[2].Devices = []*storageprovider.Device{{}}
+	topology := &storageprovider.Topology{
+		Cluster: storageprovider.StorageCluster{
+			StorageNodes: nodes,
+		},
+	}
+	p, err := getPlacement(&Class{})
+	assert.NoError(t, err)
+
+	// Without spread both devices go to the emptiest nodes in zone a
+	nodes[3].Devices = []*storageprovider.Device{{}, {}}
+	picked, err := p.Place(topology, &Class{DiskSets: 2})
+	assert.NoError(t, err)
+	assert.Equal(t, []*storageprovider.StorageNode{nodes[1], nodes[0]}, picked)
+
+	// Spread puts each device in a separate zone
+	picked, err = p.Place(topology, &Class{DiskSets: 2, Spread: SpreadPreferred})
+	assert.NoError(t, err)
+	assert.Equal(t, []*storageprovider.StorageNode{nodes[1], nodes[2]}, picked)
+
+	// Not enough zones
+	class := &Class{DiskSets: 3, Spread: SpreadPreferred}
+	picked, err = p.Place(topology, class)
+	assert.NoError(t, err)
+	assert.Len(t, picked, 3)
+	assert.Error(t, checkSpread(picked, &Class{DiskSets: 3, Spread: SpreadRequired}))
+
+	class.Spread = SpreadRequired
+	_, err = p.Place(topology, class)
+	assert.Error(t, err)
+}
+
+func TestCapacityPlacement(t *testing.T) {
+	nodes := newTestNodes("i-1", "i-2", "i-3")
+	nodes[0].Devices = []*storageprovider.Device{
+		{Size: 1024, Utilization: 90},
+	}
+	nodes[1].Devices = []*storageprovider.Device{
+		{Size: 8, Utilization: 10},
+		{Size: 8, Utilization: 10},
+	}
+	nodes[2].Devices = []*storageprovider.Device{
+		{Size: 200, Utilization: 0},
+	}
+	topology := &storageprovider.Topology{
+		Cluster: storageprovider.StorageCluster{
+			StorageNodes: nodes,
+		},
+	}
+
+	tests := []struct {
+		placement string
+		expected  []*storageprovider.StorageNode
+	}{
+		{PlacementLeastDevices, []*storageprovider.StorageNode{nodes[0], nodes[2]}},
+		{PlacementLeastCapacity, []*storageprovider.StorageNode{nodes[1], nodes[1]}},
+		{PlacementLeastFree, []*storageprovider.StorageNode{nodes[1], nodes[1]}},
+	}
+	for _, test := range tests {
+		class := &Class{
+			DiskSets:   2,
+			DiskSizeGb: 64,
+			Placement:  test.placement,
+		}
+		p, err := getPlacement(class)
+		assert.NoError(t, err)
+
+		picked, err := p.Place(topology, class)
+		assert.NoError(t, err)
+		assert.Equal(t, test.expected, picked, test.placement)
+	}
+
+	// The free space of the new devices is taken into account
+	class := &Class{
+		DiskSets:   3,
+		DiskSizeGb: 100,
+		Placement:  PlacementLeastFree,
+	}
+	p, err := getPlacement(class)
+	assert.NoError(t, err)
+	picked, err := p.Place(topology, class)
+	assert.NoError(t, err)
+	assert.Equal(t, []*storageprovider.StorageNode{
+		nodes[1], nodes[0], nodes[1],
+	}, picked)
+}
+
+func TestRackSpreadWithinZone(t *testing.T) {
+	nodes := newTestNodes("i-1", "i-2", "i-3", "i-4", "i-5")
+	racks := []struct{ zone, rack string }{
+		{"a", "r1"}, {"a", "r1"}, {"b", "r1"}, {"b", "r2"}, {"b", "r3"},
+	}
+	for i, r := range racks {
+		nodes[i].Metadata.Zone = r.zone
+		nodes[i].Metadata.Rack = r.rack
+	}
+	topology := &storageprovider.Topology{
+		Cluster: storageprovider.StorageCluster{
+			StorageNodes: nodes,
+		},
+	}
+	class := &Class{
+		DiskSets:     3,
+		Spread:       SpreadRequired,
+		SpreadLevel:  storageprovider.LevelRack,
+		SpreadWithin: storageprovider.LevelZone,
+	}
+	assert.NoError(t, class.validate())
+	p, err := getPlacement(class)
+	assert.NoError(t, err)
+
+	// Only zone b has three racks
+	picked, err := p.Place(topology, class)
+	assert.NoError(t, err)
+	assert.Equal(t, []*storageprovider.StorageNode{
+		nodes[2], nodes[3], nodes[4],
+	}, picked)
+	assert.NoError(t, checkSpread(picked, class))
+	assert.Error(t, checkSpread(nodes[1:4], class))
+
+	// No zone has four racks
+	class.DiskSets = 4
+	_, err = p.Place(topology, class)
+	assert.Error(t, err)
+
+	// Preferred spread reuses racks of the best zone
+	class.Spread = SpreadPreferred
+	picked, err = p.Place(topology, class)
+	assert.NoError(t, err)
+	assert.Equal(t, []*storageprovider.StorageNode{
+		nodes[2], nodes[3], nodes[4], nodes[2],
+	}, picked)
+
+	// Spreading must happen below the confining level
+	class.SpreadLevel = storageprovider.LevelRegion
+	assert.Error(t, class.validate())
+	class.SpreadLevel = "building"
+	assert.Error(t, class.validate())
+}
@@ -0,0 +1,597 @@
+/*
+Package inframanager provides an interface to the infrastrcture manager
+Copyright 2018 Portworx
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package inframanager
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"go.pedge.io/dlog"
+
+	"github.com/libopenstorage/rico/pkg/cloudprovider"
+	"github.com/libopenstorage/rico/pkg/storageprovider"
+)
+
+// StepAction is the change made by a step of a plan
+type StepAction string
+
+const (
+	// StepCreate creates a cloud device for the node
+	StepCreate StepAction = "create"
+
+	// StepAttach attaches the created device to the node. Cloud providers
+	// attach devices when they are created, so this step only checks
+	// that the device of the previous create step exists.
+	StepAttach StepAction = "attach"
+
+	// StepAdd adds the created device to the storage system
+	StepAdd StepAction = "add"
+
+	// StepRemove removes a device from the storage system
+	StepRemove StepAction = "remove"
+
+	// StepDelete deletes a cloud device
+	StepDelete StepAction = "delete"
+
+	// StepResize grows a cloud device
+	StepResize StepAction = "resize"
+
+	// StepExpand notifies the storage system that a device has grown
+	StepExpand StepAction = "expand"
+)
+
+// Step is a single change of a plan
+type Step struct {
+	// Action to take
+	Action StepAction `json:"action"`
+
+	// InstanceID of the node
+	InstanceID string `json:"instanceId"`
+
+	// DeviceID of an existing device, used by remove and delete steps
+	DeviceID string `json:"deviceId,omitempty"`
+
+	// Device identifies a device created by the plan. The create, attach
+	// and add steps of the same device have the same value, starting at 1.
+	Device int `json:"device,omitempty"`
+
+	// Size of the device in GiB
+	Size uint64 `json:"size"`
+
+	// PreviousSize of a device being resized in GiB
+	PreviousSize uint64 `json:"previousSize,omitempty"`
+
+	// Parameters used to create the device
+	Parameters map[string]string `json:"parameters,omitempty"`
+
+	// Reason for the step
+	Reason string `json:"reason"`
+}
+
+// Plan is an ordered list of changes for a class. Plans can be
+// serialized to JSON so that they can be reviewed and applied later.
+type Plan struct {
+	// ID of the plan
+	ID string `json:"id"`
+
+	// Class the plan was computed for
+	Class string `json:"class"`
+
+	// Created is when the plan was computed
+	Created time.Time `json:"created"`
+
+	// Utilization of the class when the plan was computed
+	Utilization int `json:"utilization"`
+
+	// Steps to take in order
+	Steps []*Step `json:"steps"`
+}
+
+// Plan returns the changes the class needs at its current utilization.
+// Stabilization samples and cooldowns are not taken into account. The
+// returned plan may have no steps.
+func (m *Manager) Plan(className string) (*Plan, error) {
+	class, err := m.class(className)
+	if err != nil {
+		return nil, err
+	}
+	utilization, err := m.utilization(class)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get utilization: %v", err)
+	}
+
+	state := m.state(class)
+	state.lock.Lock()
+	defer state.lock.Unlock()
+
+	// Planning only inspects the class, so the changes it makes to the
+	// status are dropped
+	scratch := &classState{
+		status:  state.status,
+		history: state.history,
+		pending: state.pending,
+		drains:  state.drains,
+		nodes:   state.nodes,
+	}
+	if high, reason := m.high(class, scratch, utilization); high {
+		return m.planAdd(class, scratch, utilization, reason)
+	} else if utilization < class.WatermarkLow {
+		return m.planRemove(class, scratch, utilization, lowReason(class, utilization))
+	}
+	return m.newPlan(class, utilization), nil
+}
+
+// Apply executes the steps of the plan in order. It stops at the first
+// step which fails. Plans which need approval are refused; they are
+// applied with Approve once queued.
+func (m *Manager) Apply(plan *Plan) error {
+	class, err := m.class(plan.Class)
+	if err != nil {
+		return err
+	}
+
+	state := m.state(class)
+	state.lock.Lock()
+	defer state.lock.Unlock()
+
+	if state.pending != nil && state.pending.Plan.ID == plan.ID {
+		return fmt.Errorf("Plan %s is waiting for approval", plan.ID)
+	}
+	if needsApproval(class, plan) {
+		return fmt.Errorf("Plan %s of class %s requires approval", plan.ID, class.Name)
+	}
+	return m.applyPlan(class, state, plan)
+}
+
+// applyPlan applies the plan and records the changes in the status of
+// the class. The state of the class must be locked.
+func (m *Manager) applyPlan(class *Class, state *classState, plan *Plan) error {
+	applied, err := m.apply(class, state, plan)
+	for _, step := range plan.Steps[:applied] {
+		switch step.Action {
+		case StepAdd, StepExpand:
+			state.status.LastScaleUp = m.now()
+		case StepDelete:
+			state.status.LastScaleDown = m.now()
+		}
+	}
+	return err
+}
+
+// scalesUp returns true if the steps add or grow devices
+func scalesUp(steps []*Step) bool {
+	for _, step := range steps {
+		if step.Action == StepAdd || step.Action == StepExpand {
+			return true
+		}
+	}
+	return false
+}
+
+// copy returns a copy of the plan and its steps
+func (p *Plan) copy() *Plan {
+	plan := *p
+	plan.Steps = make([]*Step, len(p.Steps))
+	for i, step := range p.Steps {
+		s := *step
+		plan.Steps[i] = &s
+	}
+	return &plan
+}
+
+// class returns the configured class with the name
+func (m *Manager) class(name string) (*Class, error) {
+	for i := range m.config.Classes {
+		if m.config.Classes[i].Name == name {
+			return &m.config.Classes[i], nil
+		}
+	}
+	return nil, fmt.Errorf("Unknown class %s", name)
+}
+
+// newPlan returns an empty plan for the class
+func (m *Manager) newPlan(class *Class, utilization int) *Plan {
+	now := m.now()
+	return &Plan{
+		ID: fmt.Sprintf("%s-%s-%d",
+			class.Name,
+			now.UTC().Format("20060102150405"),
+			atomic.AddUint64(&m.plans, 1)),
+		Class:       class.Name,
+		Created:     now,
+		Utilization: utilization,
+		Steps:       make([]*Step, 0),
+	}
+}
+
+// planAdd returns a plan which adds disk sets of the class according to
+// how far the utilization is above the high watermark. If the nodes
+// cannot attach all the disk sets, the plan only has the ones which fit.
+func (m *Manager) planAdd(
+	class *Class,
+	state *classState,
+	utilization int,
+	reason string,
+) (*Plan, error) {
+	t, err := m.topology()
+	if err != nil {
+		return nil, err
+	}
+	sets := setsToAdd(t, class, utilization)
+
+	// Only consider the nodes which support the class
+	eligible, err := eligibleTopology(t, class)
+	if err != nil {
+		return nil, err
+	}
+	capacity, err := m.attachmentCapacity(eligible)
+	if err != nil {
+		return nil, err
+	}
+
+	placement, err := getPlacement(class)
+	if err != nil {
+		return nil, err
+	}
+	slots := nodeSlots(eligible, class, capacity)
+
+	plan := m.newPlan(class, utilization)
+	state.status.AttachmentSaturated = false
+	state.status.Limit = ""
+
+	// Grow the existing devices before adding new ones
+	if class.ExpandDevices {
+		setSize := uint64(class.DiskSets) * class.DiskSizeGb
+		needed := uint64(sets) * setSize
+		grown := planExpand(plan, eligible, class, needed, m.recentlyResized(class), reason)
+		sets = 0
+		if grown < needed && setSize > 0 {
+			sets = int((needed - grown + setSize - 1) / setSize)
+		}
+	}
+
+	device := 0
+	for set := 0; set < sets; set++ {
+		if limit := addLimit(t, class); len(limit) != 0 {
+			blocked(state, limit)
+			break
+		}
+
+		// Only consider the nodes which can attach another device
+		attachable := attachableTopology(eligible, capacity)
+		if len(attachable.Cluster.StorageNodes) == 0 {
+			state.status.AttachmentSaturated = true
+			if len(plan.Steps) == 0 {
+				return nil, ErrAttachmentSaturated
+			}
+			break
+		}
+		attachable = attachableTopology(attachable, slots)
+		if len(attachable.Cluster.StorageNodes) == 0 {
+			blocked(state, fmt.Sprintf("Class %s is limited to %d devices per node",
+				class.Name,
+				class.MaxDevicesPerNode))
+			break
+		}
+
+		// Pick the nodes for the disk set
+		nodes, err := placement.Place(attachable, class)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to place devices for class %s: %v",
+				class.Name,
+				err)
+		}
+		if err := checkSpread(nodes, class); err != nil {
+			return nil, err
+		}
+		if err := checkCapacity(nodes, slots); err != nil {
+			return nil, err
+		}
+
+		stepReason := fmt.Sprintf("%s, disk set %d of %d", reason, set+1, sets)
+		for _, node := range nodes {
+			device++
+			for _, action := range []StepAction{StepCreate, StepAttach, StepAdd} {
+				plan.Steps = append(plan.Steps, &Step{
+					Action:     action,
+					InstanceID: node.Metadata.ID,
+					Device:     device,
+					Size:       class.DiskSizeGb,
+					Parameters: class.Parameters,
+					Reason:     stepReason,
+				})
+			}
+
+			// Account for the device in the next disk sets
+			node.Devices = append(node.Devices, &storageprovider.Device{
+				Size: class.DiskSizeGb,
+				Metadata: storageprovider.DeviceMetadata{
+					Class: class.Name,
+				},
+			})
+			if capacity[node] > 0 {
+				capacity[node]--
+			}
+			if slots[node] > 0 {
+				slots[node]--
+			}
+		}
+	}
+
+	return plan, nil
+}
+
+// planRemove returns a plan which removes devices of the class according
+// to how far the utilization is below the low watermark
+func (m *Manager) planRemove(
+	class *Class,
+	state *classState,
+	utilization int,
+	reason string,
+) (*Plan, error) {
+	t, err := m.topology()
+	if err != nil {
+		return nil, err
+	}
+	devices, minCapacity := devicesToRemove(t, class, utilization)
+
+	removal, err := getRemoval(class)
+	if err != nil {
+		return nil, err
+	}
+	plan := m.newPlan(class, utilization)
+	state.status.Limit = ""
+	for removed := 0; removed < devices; removed++ {
+		// Pick a device
+		candidate, err := removal.Select(t, class, removalCandidates(t, class))
+		if err != nil {
+			return nil, fmt.Errorf("Failed to select device to remove for class %s: %v",
+				class.Name,
+				err)
+		}
+
+		// Nothing to do
+		if candidate == nil {
+			break
+		}
+		node, device := candidate.Node, candidate.Device
+		if classCapacity(t, class) < minCapacity+device.Size {
+			break
+		}
+		if limit := removeLimit(t, class, device); len(limit) != 0 {
+			blocked(state, limit)
+			break
+		}
+
+		for _, action := range []StepAction{StepRemove, StepDelete} {
+			plan.Steps = append(plan.Steps, &Step{
+				Action:     action,
+				InstanceID: node.Metadata.ID,
+				DeviceID:   device.Metadata.ID,
+				Size:       device.Size,
+				Reason:     reason,
+			})
+		}
+
+		// Account for the device in the next selection
+		for i, d := range node.Devices {
+			if d == device {
+				node.Devices = append(node.Devices[:i], node.Devices[i+1:]...)
+				break
+			}
+		}
+	}
+	return plan, nil
+}
+
+// apply executes the steps of the plan and returns the number of steps
+// which succeeded. Devices are only deleted from the cloud once the
+// storage system has drained them, so delete steps of devices which are
+// still draining are completed later.
+func (m *Manager) apply(class *Class, state *classState, plan *Plan) (int, error) {
+	t, err := m.storage.GetTopology()
+	if err != nil {
+		return 0, fmt.Errorf("Failed to get topology: %v", err)
+	}
+
+	created := make(map[int]*cloudprovider.Device)
+	defer func() {
+		for _, device := range created {
+			m.setCreating(device.ID, false)
+		}
+	}()
+	for i, step := range plan.Steps {
+		node := findNode(t, step.InstanceID)
+		if node == nil {
+			return i, fmt.Errorf("Node %s of plan %s not found", step.InstanceID, plan.ID)
+		}
+		device, ok := created[step.Device]
+		if !ok && (step.Action == StepAttach || step.Action == StepAdd) {
+			return i, fmt.Errorf("Device %d of plan %s was not created", step.Device, plan.ID)
+		}
+
+		// The plan may have been computed long ago, so check the limits
+		// of the class against the current topology
+		switch step.Action {
+		case StepCreate, StepRemove, StepResize:
+			live, err := m.storage.GetTopology()
+			if err != nil {
+				return i, fmt.Errorf("Failed to get topology: %v", err)
+			}
+			if limit := stepLimit(live, class, step); len(limit) != 0 {
+				blocked(state, limit)
+				return i, fmt.Errorf("Step %d of plan %s refused: %s", i+1, plan.ID, limit)
+			}
+		}
+
+		switch step.Action {
+		case StepCreate:
+			// Create and attach a disk to the node
+			device, err := m.cloud.DeviceCreate(node.Metadata.ID, &cloudprovider.DeviceSpecs{
+				Size:       step.Size,
+				Parameters: step.Parameters,
+			})
+			if err != nil {
+				return i, fmt.Errorf("Failed to add disk to node %s: %v",
+					node.Metadata.ID,
+					err)
+			}
+			created[step.Device] = device
+			m.setCreating(device.ID, true)
+
+		case StepAttach:
+			// Attached when created
+
+		case StepAdd:
+			// Notify storage system device has been added
+			err := m.storage.DeviceAdd(node, &storageprovider.Device{
+				Path: device.Path,
+				Size: device.Size,
+				Metadata: storageprovider.DeviceMetadata{
+					ID:      device.ID,
+					Created: device.Created,
+					Class:   plan.Class,
+				},
+			})
+			if err != nil {
+				return i, m.rollback(node.Metadata.ID, device.ID,
+					fmt.Errorf("Failed to add device %s to node %s: %v",
+						device.ID,
+						node.Metadata.ID,
+						err))
+			}
+
+		case StepRemove:
+			// Remove drive from the storage system
+			device := findDevice(node, step.DeviceID)
+			if device == nil {
+				return i, fmt.Errorf("Device %s not found on node %s",
+					step.DeviceID,
+					node.Metadata.ID)
+			}
+			if err := m.storage.DeviceRemove(node, device); err != nil {
+				return i, err
+			}
+			status, err := m.storage.DeviceRemoveStatus(node, device)
+			if err != nil {
+				return i, fmt.Errorf("Failed to get removal status of device %s: %v",
+					device.Metadata.ID,
+					err)
+			}
+			switch status.State {
+			case storageprovider.RemoveDone:
+			case storageprovider.RemoveFailed:
+				return i, fmt.Errorf("Failed to remove device %s from node %s: %s",
+					device.Metadata.ID,
+					node.Metadata.ID,
+					status.Message)
+			default:
+				m.startDrain(state, node, device, status)
+			}
+
+		case StepDelete:
+			// Delete cloud drive once drained
+			if _, ok := state.drains[step.DeviceID]; ok {
+				continue
+			}
+			if err := m.cloud.DeviceDelete(node.Metadata.ID, step.DeviceID); err != nil {
+				return i, err
+			}
+
+		case StepResize:
+			// Grow cloud drive. Failed attempts also count, since the
+			// cloud may limit how often a device is modified.
+			m.setResized(step.DeviceID)
+			err := m.cloud.DeviceResize(node.Metadata.ID, step.DeviceID, step.Size)
+			if err != nil {
+				return i, err
+			}
+
+		case StepExpand:
+			// Notify storage system device has grown
+			device := findDevice(node, step.DeviceID)
+			if device == nil {
+				return i, fmt.Errorf("Device %s not found on node %s",
+					step.DeviceID,
+					node.Metadata.ID)
+			}
+			expanded := *device
+			expanded.Size = step.Size
+			if err := m.storage.DeviceExpanded(node, &expanded); err != nil {
+				return i, err
+			}
+
+		default:
+			return i, fmt.Errorf("Unknown action %s in plan %s", step.Action, plan.ID)
+		}
+	}
+	return len(plan.Steps), nil
+}
+
+// rollback deletes a cloud device which the storage system refused to
+// add. If the device cannot be deleted, it is reported as an orphan.
+func (m *Manager) rollback(instanceID, deviceID string, addErr error) error {
+	if err := m.cloud.DeviceDelete(instanceID, deviceID); err != nil {
+		m.addOrphan(instanceID, deviceID,
+			fmt.Sprintf("Failed to roll back device: %v", err),
+			false)
+		return fmt.Errorf("%v. Failed to roll back device %s: %v", addErr, deviceID, err)
+	}
+	dlog.Infof("Rolled back device %s of instance %s", deviceID, instanceID)
+	return addErr
+}
+
+// findNode returns the node with the instance ID or nil if not found
+func findNode(t *storageprovider.Topology, instanceID string) *storageprovider.StorageNode {
+	for _, node := range t.Cluster.StorageNodes {
+		if node.Metadata.ID == instanceID {
+			return node
+		}
+	}
+	return nil
+}
+
+// findDevice returns the device of the node with the ID or nil if not found
+func findDevice(node *storageprovider.StorageNode, deviceID string) *storageprovider.Device {
+	for _, device := range node.Devices {
+		if device.Metadata.ID == deviceID {
+			return device
+		}
+	}
+	return nil
+}
+
+// highReason describes why storage is added to the class
+func highReason(class *Class, utilization int) string {
+	if utilization > class.WatermarkHigh {
+		return fmt.Sprintf("utilization %d%% is above the high watermark %d%%",
+			utilization,
+			class.WatermarkHigh)
+	}
+	return fmt.Sprintf("utilization %d%% is projected to reach the high watermark %d%% within %v",
+		utilization,
+		class.WatermarkHigh,
+		class.Predictive.LeadTime)
+}
+
+// lowReason describes why storage is removed from the class
+func lowReason(class *Class, utilization int) string {
+	return fmt.Sprintf("utilization %d%% is below the low watermark %d%%",
+		utilization,
+		class.WatermarkLow)
+}
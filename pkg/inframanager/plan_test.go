@@ -0,0 +1,191 @@
+/*
+Package inframanager provides an interface to the infrastrcture manager
+Copyright 2018 Portworx
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package inframanager
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	cloudfake "github.com/libopenstorage/rico/pkg/cloudprovider/fake"
+	"github.com/libopenstorage/rico/pkg/storageprovider"
+	"github.com/libopenstorage/rico/pkg/storageprovider/fake"
+)
+
+func TestPlanApply(t *testing.T) {
+	storage := fake.New(&storageprovider.Topology{
+		Cluster: storageprovider.StorageCluster{
+			StorageNodes: newTestNodes("i-1", "i-2"),
+		},
+	})
+	cloud := cloudfake.New()
+	class := Class{
+		Name:          "gp2",
+		Parameters:    map[string]string{"type": "gp2"},
+		WatermarkHigh: 75,
+		WatermarkLow:  25,
+		DiskSets:      2,
+		DiskSizeGb:    8,
+	}
+	im := NewManager(&Config{Classes: []Class{class}}, cloud, storage)
+
+	_, err := im.Plan("unknown")
+	assert.Error(t, err)
+
+	// Nothing to do
+	storage.CurrentUtilization = 50
+	plan, err := im.Plan("gp2")
+	assert.NoError(t, err)
+	assert.Len(t, plan.Steps, 0)
+
+	// Planning does not change anything
+	storage.CurrentUtilization = 80
+	plan, err = im.Plan("gp2")
+	assert.NoError(t, err)
+	assert.Equal(t, "gp2", plan.Class)
+	assert.Equal(t, 80, plan.Utilization)
+	assert.Equal(t, 0, cloud.NumDevices())
+	actions := make([]StepAction, len(plan.Steps))
+	for i, step := range plan.Steps {
+		actions[i] = step.Action
+	}
+	assert.Equal(t, []StepAction{
+		StepCreate, StepAttach, StepAdd,
+		StepCreate, StepAttach, StepAdd,
+	}, actions)
+	assert.Equal(t, "i-1", plan.Steps[0].InstanceID)
+	assert.Equal(t, 1, plan.Steps[0].Device)
+	assert.Equal(t, "i-2", plan.Steps[3].InstanceID)
+	assert.Equal(t, 2, plan.Steps[3].Device)
+	assert.Equal(t, uint64(8), plan.Steps[0].Size)
+	assert.Equal(t, class.Parameters, plan.Steps[0].Parameters)
+	assert.Contains(t, plan.Steps[0].Reason, "high watermark")
+	status, err := im.Status("gp2")
+	assert.NoError(t, err)
+	assert.Equal(t, ClassStatus{Draining: []Drain{}}, *status)
+
+	// Plans survive a round trip through JSON
+	data, err := json.Marshal(plan)
+	assert.NoError(t, err)
+	var decoded Plan
+	assert.NoError(t, json.Unmarshal(data, &decoded))
+	assert.Equal(t, plan.ID, decoded.ID)
+	assert.Equal(t, plan.Steps, decoded.Steps)
+
+	assert.NoError(t, im.Apply(&decoded))
+	assert.Equal(t, 2, cloud.NumDevices())
+	assert.Equal(t, 2, storage.NumDevices())
+	status, err = im.Status("gp2")
+	assert.NoError(t, err)
+	assert.False(t, status.LastScaleUp.IsZero())
+
+	// Remove a device
+	storage.CurrentUtilization = 10
+	plan, err = im.Plan("gp2")
+	assert.NoError(t, err)
+	assert.Len(t, plan.Steps, 2)
+	assert.Equal(t, StepRemove, plan.Steps[0].Action)
+	assert.Equal(t, StepDelete, plan.Steps[1].Action)
+	assert.Equal(t, plan.Steps[0].DeviceID, plan.Steps[1].DeviceID)
+	assert.NoError(t, im.Apply(plan))
+	assert.Equal(t, 1, cloud.NumDevices())
+	assert.Equal(t, 1, storage.NumDevices())
+
+	// The device is gone
+	err = im.Apply(plan)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), plan.Steps[0].DeviceID)
+
+	// Plans must create devices before adding them
+	err = im.Apply(&Plan{
+		ID:    "bad",
+		Class: "gp2",
+		Steps: []*Step{{Action: StepAdd, InstanceID: "i-1", Device: 1}},
+	})
+	assert.Error(t, err)
+	assert.Equal(t, 1, storage.NumDevices())
+}
+
+func TestApplyRollback(t *testing.T) {
+	storage := fake.New(&storageprovider.Topology{
+		Cluster: storageprovider.StorageCluster{
+			StorageNodes: newTestNodes("i-1"),
+		},
+	})
+	storage.CurrentUtilization = 80
+	storage.AddError = fmt.Errorf("device refused")
+	cloud := cloudfake.New()
+	class := Class{
+		Name:          "gp2",
+		WatermarkHigh: 75,
+		DiskSets:      1,
+		DiskSizeGb:    8,
+	}
+	im := NewManager(&Config{Classes: []Class{class}}, cloud, storage)
+
+	// The cloud device is deleted when the storage system refuses it
+	err := im.do(&class)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "device refused")
+	assert.Equal(t, 0, cloud.NumDevices())
+	assert.Len(t, im.Orphans(), 0)
+
+	// Devices which cannot be deleted are orphans
+	cloud.DeleteError = fmt.Errorf("delete failed")
+	err = im.do(&class)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "delete failed")
+	assert.Equal(t, 1, cloud.NumDevices())
+	orphans := im.Orphans()
+	assert.Len(t, orphans, 1)
+	assert.Equal(t, "i-1", orphans[0].InstanceID)
+	assert.False(t, orphans[0].Adopt)
+}
+
+func TestPlanStatus(t *testing.T) {
+	storage := fake.New(&storageprovider.Topology{
+		Cluster: storageprovider.StorageCluster{
+			StorageNodes: newTestNodes("i-1", "i-2"),
+		},
+	})
+	storage.CurrentUtilization = 80
+	class := Class{
+		Name:          "gp2",
+		WatermarkHigh: 75,
+		WatermarkLow:  25,
+		DiskSets:      2,
+		DiskSizeGb:    8,
+		MaxDevices:    1,
+	}
+	im := NewManager(&Config{Classes: []Class{class}}, cloudfake.New(), storage)
+
+	// Limits reached while planning are not recorded
+	plan, err := im.Plan("gp2")
+	assert.NoError(t, err)
+	assert.Len(t, plan.Steps, 0)
+	status, err := im.Status("gp2")
+	assert.NoError(t, err)
+	assert.Equal(t, "", status.Limit)
+
+	// Unlike when the class is checked
+	assert.NoError(t, im.do(&class))
+	status, err = im.Status("gp2")
+	assert.NoError(t, err)
+	assert.Contains(t, status.Limit, "1 devices")
+}
@@ -0,0 +1,188 @@
+/*
+Package inframanager provides an interface to the infrastrcture manager
+Copyright 2018 Portworx
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package inframanager
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/libopenstorage/rico/pkg/storageprovider"
+)
+
+const (
+	// RemovalLeastUtilized removes the device with the lowest utilization.
+	// This is the default.
+	RemovalLeastUtilized = "leastutilized"
+
+	// RemovalNewest removes the most recently created device
+	RemovalNewest = "newest"
+
+	// RemovalOldest removes the device created first
+	RemovalOldest = "oldest"
+
+	// RemovalMostLoadedNode removes the least utilized device from the
+	// node with the most devices
+	RemovalMostLoadedNode = "mostloadednode"
+
+	// RemovalCheapestEvacuate removes the device with the least amount
+	// of data to move
+	RemovalCheapestEvacuate = "cheapestevacuate"
+)
+
+// RemovalCandidate is a device which may be removed from the cluster
+type RemovalCandidate struct {
+	Node   *storageprovider.StorageNode
+	Device *storageprovider.Device
+}
+
+// Removal is the interface to an algorithm which decides which device
+// to remove from the cluster
+type Removal interface {
+	// Select returns the device to remove from the candidates, or nil
+	// if none should be removed. Candidates only contain devices which
+	// the class allows to be removed.
+	Select(
+		t *storageprovider.Topology,
+		class *Class,
+		candidates []*RemovalCandidate,
+	) (*RemovalCandidate, error)
+}
+
+var (
+	removalsLock sync.Mutex
+	removals     = map[string]Removal{
+		RemovalLeastUtilized: candidateLess(func(a, b *RemovalCandidate) bool {
+			return a.Device.Utilization < b.Device.Utilization
+		}),
+		RemovalNewest: candidateLess(func(a, b *RemovalCandidate) bool {
+			return a.Device.Metadata.Created.After(b.Device.Metadata.Created)
+		}),
+		RemovalOldest: candidateLess(func(a, b *RemovalCandidate) bool {
+			return a.Device.Metadata.Created.Before(b.Device.Metadata.Created)
+		}),
+		RemovalMostLoadedNode: candidateLess(func(a, b *RemovalCandidate) bool {
+			if len(a.Node.Devices) != len(b.Node.Devices) {
+				return len(a.Node.Devices) > len(b.Node.Devices)
+			}
+			return a.Device.Utilization < b.Device.Utilization
+		}),
+		RemovalCheapestEvacuate: candidateLess(func(a, b *RemovalCandidate) bool {
+			usedA := a.Device.Size * uint64(a.Device.Utilization)
+			usedB := b.Device.Size * uint64(b.Device.Utilization)
+			if usedA != usedB {
+				return usedA < usedB
+			}
+			return a.Device.Size < b.Device.Size
+		}),
+	}
+)
+
+// RegisterRemoval registers a removal algorithm which can then be
+// selected by setting Class.Removal to its name
+func RegisterRemoval(name string, r Removal) error {
+	removalsLock.Lock()
+	defer removalsLock.Unlock()
+
+	if len(name) == 0 {
+		return fmt.Errorf("Removal name must not be empty")
+	}
+	if r == nil {
+		return fmt.Errorf("Removal %s is nil", name)
+	}
+	if _, ok := removals[name]; ok {
+		return fmt.Errorf("Removal %s already registered", name)
+	}
+	removals[name] = r
+	return nil
+}
+
+// getRemoval returns the removal algorithm for the class
+func getRemoval(class *Class) (Removal, error) {
+	removalsLock.Lock()
+	defer removalsLock.Unlock()
+
+	name := class.Removal
+	if len(name) == 0 {
+		name = RemovalLeastUtilized
+	}
+	r, ok := removals[name]
+	if !ok {
+		return nil, fmt.Errorf("Unknown removal %s for class %s", name, class.Name)
+	}
+	return r, nil
+}
+
+// removalCandidates returns the devices in the topology which the class
+// allows to be removed. Only nodes which support the class are considered.
+func removalCandidates(t *storageprovider.Topology, class *Class) []*RemovalCandidate {
+	// Count the devices of the class in each failure domain
+	level := class.removalLevel()
+	domains := make(map[string]int)
+	for _, node := range t.Cluster.StorageNodes {
+		for _, device := range node.Devices {
+			if deviceInClass(device, class) {
+				domains[node.Metadata.FailureDomain(level)]++
+			}
+		}
+	}
+
+	candidates := make([]*RemovalCandidate, 0)
+	for _, node := range t.Cluster.StorageNodes {
+		if domains[node.Metadata.FailureDomain(level)] <= class.MinDevicesPerDomain {
+			continue
+		}
+		if len(node.Devices) <= class.MinDevicesPerNode ||
+			!nodeSupportsClass(node, class) {
+			continue
+		}
+		for _, device := range node.Devices {
+			if !deviceInClass(device, class) {
+				continue
+			}
+			candidates = append(candidates, &RemovalCandidate{
+				Node:   node,
+				Device: device,
+			})
+		}
+	}
+	return candidates
+}
+
+// deviceInClass returns true if the device was added for the class.
+// Devices with no class are considered part of every class.
+func deviceInClass(device *storageprovider.Device, class *Class) bool {
+	return len(device.Metadata.Class) == 0 ||
+		device.Metadata.Class == class.Name
+}
+
+// candidateLess is a removal algorithm which selects the candidate
+// which sorts first
+type candidateLess func(a, b *RemovalCandidate) bool
+
+func (less candidateLess) Select(
+	t *storageprovider.Topology,
+	class *Class,
+	candidates []*RemovalCandidate,
+) (*RemovalCandidate, error) {
+	var selected *RemovalCandidate
+	for _, candidate := range candidates {
+		if selected == nil || less(candidate, selected) {
+			selected = candidate
+		}
+	}
+	return selected, nil
+}
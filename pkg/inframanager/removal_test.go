@@ -0,0 +1,119 @@
+/*
+Package inframanager provides an interface to the infrastrcture manager
+Copyright 2018 Portworx
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package inframanager
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/libopenstorage/rico/pkg/storageprovider"
+)
+
+func TestRemovalPolicies(t *testing.T) {
+	now := time.Now()
+	newDevice := func(id string, size uint64, utilization int, age time.Duration) *storageprovider.Device {
+		return &storageprovider.Device{
+			Size:        size,
+			Utilization: utilization,
+			Metadata: storageprovider.DeviceMetadata{
+				ID:      id,
+				Created: now.Add(-age),
+			},
+		}
+	}
+
+	nodes := newTestNodes("i-1", "i-2")
+	nodes[0].Devices = []*storageprovider.Device{
+		newDevice("vol-1", 100, 10, time.Hour),
+		newDevice("vol-2", 8, 50, 3*time.Hour),
+		newDevice("vol-3", 100, 20, time.Minute),
+	}
+	nodes[1].Devices = []*storageprovider.Device{
+		newDevice("vol-4", 8, 5, 2*time.Hour),
+	}
+	topology := &storageprovider.Topology{
+		Cluster: storageprovider.StorageCluster{
+			StorageNodes: nodes,
+		},
+	}
+
+	tests := []struct {
+		removal           string
+		minDevicesPerNode int
+		expected          string
+	}{
+		{"", 0, "vol-4"},
+		{RemovalLeastUtilized, 1, "vol-1"},
+		{RemovalNewest, 0, "vol-3"},
+		{RemovalOldest, 0, "vol-2"},
+		{RemovalMostLoadedNode, 0, "vol-1"},
+		{RemovalCheapestEvacuate, 0, "vol-4"},
+		{RemovalCheapestEvacuate, 1, "vol-2"},
+	}
+	for _, test := range tests {
+		class := &Class{
+			Removal:           test.removal,
+			MinDevicesPerNode: test.minDevicesPerNode,
+		}
+		r, err := getRemoval(class)
+		assert.NoError(t, err)
+
+		candidate, err := r.Select(topology, class, removalCandidates(topology, class))
+		assert.NoError(t, err)
+		assert.NotNil(t, candidate)
+		assert.Equal(t, test.expected, candidate.Device.Metadata.ID, test.removal)
+	}
+
+	// Devices of other classes are never candidates
+	nodes[1].Devices[0].Metadata.Class = "io1"
+	class := &Class{Name: "gp2", MinDevicesPerNode: 3}
+	assert.Empty(t, removalCandidates(topology, class))
+
+	_, err := getRemoval(&Class{Removal: "unknown"})
+	assert.Error(t, err)
+}
+
+func TestRemovalKeepsDevicesPerDomain(t *testing.T) {
+	nodes := newTestNodes("i-1", "i-2", "i-3")
+	nodes[0].Metadata.Rack = "r1"
+	nodes[1].Metadata.Rack = "r1"
+	nodes[2].Metadata.Rack = "r2"
+	nodes[0].Devices = []*storageprovider.Device{{Utilization: 40}}
+	nodes[1].Devices = []*storageprovider.Device{{Utilization: 30}}
+	nodes[2].Devices = []*storageprovider.Device{{Utilization: 10}}
+	topology := &storageprovider.Topology{
+		Cluster: storageprovider.StorageCluster{
+			StorageNodes: nodes,
+		},
+	}
+	class := &Class{
+		MinDevicesPerDomain: 1,
+		RemovalLevel:        storageprovider.LevelRack,
+	}
+	r, err := getRemoval(class)
+	assert.NoError(t, err)
+
+	// The only device in rack r2 is kept
+	candidate, err := r.Select(topology, class, removalCandidates(topology, class))
+	assert.NoError(t, err)
+	assert.Equal(t, nodes[1], candidate.Node)
+
+	class.MinDevicesPerDomain = 2
+	assert.Empty(t, removalCandidates(topology, class))
+}
@@ -0,0 +1,127 @@
+/*
+Package inframanager provides an interface to the infrastrcture manager
+Copyright 2018 Portworx
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package inframanager
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/libopenstorage/rico/pkg/storageprovider"
+)
+
+// ScalingStep scales by a larger amount the further utilization is past
+// a watermark
+type ScalingStep struct {
+	// Utilization at which the step applies. Scale up steps apply when
+	// utilization is above this value, and scale down steps when it is
+	// below.
+	Utilization int
+
+	// Count is the number of disk sets to add for scale up steps, or
+	// the number of devices to remove for scale down steps
+	Count int
+}
+
+func validateSteps(steps []ScalingStep) error {
+	for _, step := range steps {
+		if step.Count <= 0 {
+			return fmt.Errorf("Step at %d%% must have a positive count",
+				step.Utilization)
+		}
+	}
+	return nil
+}
+
+// scaleUpSets returns the number of disk sets to add at the utilization.
+// The step with the highest utilization below the current utilization
+// is used, and one disk set is added if none apply.
+func scaleUpSets(class *Class, utilization int) int {
+	sets := 1
+	threshold := -1
+	for _, step := range class.ScaleUpSteps {
+		if utilization > step.Utilization && step.Utilization > threshold {
+			threshold = step.Utilization
+			sets = step.Count
+		}
+	}
+	return sets
+}
+
+// scaleDownDevices returns the number of devices to remove at the
+// utilization. The step with the lowest utilization above the current
+// utilization is used, and one device is removed if none apply.
+func scaleDownDevices(class *Class, utilization int) int {
+	devices := 1
+	threshold := 101
+	for _, step := range class.ScaleDownSteps {
+		if utilization < step.Utilization && step.Utilization < threshold {
+			threshold = step.Utilization
+			devices = step.Count
+		}
+	}
+	return devices
+}
+
+// setsToAdd returns the number of disk sets to add at the utilization
+func setsToAdd(t *storageprovider.Topology, class *Class, utilization int) int {
+	if class.TargetUtilization == 0 {
+		return scaleUpSets(class, utilization)
+	}
+
+	capacity := classCapacity(t, class)
+	setSize := class.DiskSizeGb * uint64(class.DiskSets)
+	target := targetCapacity(class, utilization, capacity)
+	if capacity == 0 || setSize == 0 || target <= capacity {
+		return 1
+	}
+	return int((target - capacity + setSize - 1) / setSize)
+}
+
+// devicesToRemove returns the maximum number of devices to remove at the
+// utilization and the capacity in GiB the class must keep
+func devicesToRemove(t *storageprovider.Topology, class *Class, utilization int) (int, uint64) {
+	if class.TargetUtilization == 0 {
+		return scaleDownDevices(class, utilization), 0
+	}
+
+	capacity := classCapacity(t, class)
+	return math.MaxInt32, targetCapacity(class, utilization, capacity)
+}
+
+// targetCapacity returns the capacity in GiB the class needs for the
+// utilization to be at its target
+func targetCapacity(class *Class, utilization int, capacity uint64) uint64 {
+	used := capacity * uint64(utilization)
+	target := uint64(class.TargetUtilization)
+	return (used + target - 1) / target
+}
+
+// classCapacity returns the total size in GiB of the devices of the class
+func classCapacity(t *storageprovider.Topology, class *Class) uint64 {
+	var capacity uint64
+	for _, node := range t.Cluster.StorageNodes {
+		if !nodeSupportsClass(node, class) {
+			continue
+		}
+		for _, device := range node.Devices {
+			if deviceInClass(device, class) {
+				capacity += device.Size
+			}
+		}
+	}
+	return capacity
+}
@@ -0,0 +1,130 @@
+/*
+Package inframanager provides an interface to the infrastrcture manager
+Copyright 2018 Portworx
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package inframanager
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/libopenstorage/rico/pkg/cloudprovider"
+	cloudfake "github.com/libopenstorage/rico/pkg/cloudprovider/fake"
+	"github.com/libopenstorage/rico/pkg/storageprovider"
+	"github.com/libopenstorage/rico/pkg/storageprovider/fake"
+)
+
+func TestStepScaling(t *testing.T) {
+	storage := fake.New(&storageprovider.Topology{
+		Cluster: storageprovider.StorageCluster{
+			StorageNodes: newTestNodes("i-1", "i-2", "i-3"),
+		},
+	})
+	class := Class{
+		Name:          "gp2",
+		WatermarkHigh: 75,
+		WatermarkLow:  25,
+		DiskSets:      2,
+		DiskSizeGb:    8,
+		ScaleUpSteps: []ScalingStep{
+			{Utilization: 90, Count: 3},
+			{Utilization: 75, Count: 1},
+		},
+		ScaleDownSteps: []ScalingStep{
+			{Utilization: 25, Count: 1},
+			{Utilization: 10, Count: 4},
+		},
+	}
+	assert.NoError(t, class.validate())
+	assert.Equal(t, 1, scaleUpSets(&class, 76))
+	assert.Equal(t, 3, scaleUpSets(&class, 99))
+	assert.Equal(t, 1, scaleDownDevices(&class, 20))
+	assert.Equal(t, 4, scaleDownDevices(&class, 5))
+
+	im := NewManager(&Config{Classes: []Class{class}}, cloudfake.New(), storage)
+
+	storage.CurrentUtilization = 76
+	assert.NoError(t, im.do(&class))
+	assert.Equal(t, 2, storage.NumDevices())
+
+	// Three sets are spread over the nodes as if added one at a time
+	storage.CurrentUtilization = 95
+	assert.NoError(t, im.do(&class))
+	assert.Equal(t, 8, storage.NumDevices())
+	for _, node := range storage.Topology.Cluster.StorageNodes {
+		assert.True(t, len(node.Devices) >= 2)
+		assert.True(t, len(node.Devices) <= 3)
+	}
+
+	storage.CurrentUtilization = 5
+	assert.NoError(t, im.do(&class))
+	assert.Equal(t, 4, storage.NumDevices())
+
+	storage.CurrentUtilization = 20
+	assert.NoError(t, im.do(&class))
+	assert.Equal(t, 3, storage.NumDevices())
+
+	class.ScaleUpSteps = []ScalingStep{{Utilization: 80}}
+	assert.Error(t, class.validate())
+}
+
+func TestTargetTracking(t *testing.T) {
+	cloud := cloudfake.New()
+	nodes := newTestNodes("i-1", "i-2")
+	for _, node := range nodes {
+		for i := 0; i < 2; i++ {
+			device, err := cloud.DeviceCreate(node.Metadata.ID, &cloudprovider.DeviceSpecs{
+				Size: 100,
+			})
+			assert.NoError(t, err)
+			node.Devices = append(node.Devices, &storageprovider.Device{
+				Size:     device.Size,
+				Metadata: storageprovider.DeviceMetadata{ID: device.ID},
+			})
+		}
+	}
+	storage := fake.New(&storageprovider.Topology{
+		Cluster: storageprovider.StorageCluster{
+			StorageNodes: nodes,
+		},
+	})
+	class := Class{
+		Name:              "gp2",
+		WatermarkHigh:     75,
+		WatermarkLow:      25,
+		DiskSets:          1,
+		DiskSizeGb:        50,
+		TargetUtilization: 60,
+	}
+	assert.NoError(t, class.validate())
+	im := NewManager(&Config{Classes: []Class{class}}, cloud, storage)
+
+	// 360 GiB used needs 600 GiB to be at 60%
+	storage.CurrentUtilization = 90
+	assert.NoError(t, im.do(&class))
+	assert.Equal(t, uint64(600), classCapacity(storage.Topology, &class))
+	assert.Equal(t, 8, storage.NumDevices())
+
+	// 120 GiB used needs 200 GiB to be at 60%
+	storage.CurrentUtilization = 20
+	assert.NoError(t, im.do(&class))
+	capacity := classCapacity(storage.Topology, &class)
+	assert.True(t, capacity >= 200)
+	assert.True(t, capacity < 250)
+
+	class.TargetUtilization = 101
+	assert.Error(t, class.validate())
+}
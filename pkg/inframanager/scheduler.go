@@ -0,0 +1,380 @@
+/*
+Package inframanager provides an interface to the infrastrcture manager
+Copyright 2018 Portworx
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package inframanager
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/libopenstorage/rico/pkg/storageprovider"
+)
+
+const (
+	// PlacementScheduler places devices using the filter and score
+	// plugins configured in Class.Scheduler
+	PlacementScheduler = "scheduler"
+
+	// MaxScore is the highest score returned by the built-in score plugins
+	MaxScore = 100
+
+	// ScoreLeastDevices favors the nodes with the fewest devices
+	ScoreLeastDevices = "leastdevices"
+
+	// ScoreLeastCapacity favors the nodes with the fewest provisioned GiB
+	ScoreLeastCapacity = "leastcapacity"
+
+	// ScoreLeastFree favors the nodes with the fewest unused GiB
+	ScoreLeastFree = "leastfree"
+
+	// ScoreAffinity returns the preferred affinity score of the class.
+	// See Class.AffinityScore.
+	ScoreAffinity = "affinity"
+
+	// ScoreSpread favors the nodes in the failure domains at
+	// Class.SpreadLevel with the fewest devices of the current disk set
+	ScoreSpread = "spread"
+)
+
+// ScorePlugin ranks the nodes which passed the filters
+type ScorePlugin interface {
+	// Score returns the score of the node for the next device of the
+	// class. Nodes with higher scores are preferred. The topology only
+	// contains the candidate nodes, and pending has the number of
+	// devices already picked for each node in the current disk set.
+	Score(
+		t *storageprovider.Topology,
+		class *Class,
+		node *storageprovider.StorageNode,
+		pending PendingDevices,
+	) int64
+}
+
+// ScoreFunc is an adapter to use a function as a ScorePlugin
+type ScoreFunc func(
+	t *storageprovider.Topology,
+	class *Class,
+	node *storageprovider.StorageNode,
+	pending PendingDevices,
+) int64
+
+// Score calls f(t, class, node, pending)
+func (f ScoreFunc) Score(
+	t *storageprovider.Topology,
+	class *Class,
+	node *storageprovider.StorageNode,
+	pending PendingDevices,
+) int64 {
+	return f(t, class, node, pending)
+}
+
+// WeightedScore is a score plugin and the weight of its score
+type WeightedScore struct {
+	// Name of the score plugin
+	Name string
+
+	// Weight multiplies the score of the plugin
+	Weight int64
+}
+
+// SchedulerConfig configures PlacementScheduler for a class
+type SchedulerConfig struct {
+	// Filters are the names of the filter plugins applied after the
+	// default filters
+	Filters []string
+
+	// Scores are the score plugins used to rank the nodes. Defaults to
+	// ScoreLeastDevices and ScoreAffinity with a weight of 1.
+	Scores []WeightedScore
+}
+
+// NodeScore is the result of running the scheduler for a node
+type NodeScore struct {
+	// Node which was scored
+	Node *storageprovider.StorageNode
+
+	// Reason is set if the node was removed by a filter
+	Reason string
+
+	// Scores has the weighted score of each plugin
+	Scores map[string]int64
+
+	// Total is the sum of the weighted scores
+	Total int64
+}
+
+var (
+	scoresLock sync.Mutex
+	scores     = map[string]ScorePlugin{
+		ScoreLeastDevices: ScoreFunc(func(
+			t *storageprovider.Topology,
+			class *Class,
+			node *storageprovider.StorageNode,
+			pending PendingDevices,
+		) int64 {
+			return inverseScore(t, node, func(n *storageprovider.StorageNode) uint64 {
+				return uint64(len(n.Devices) + pending[n])
+			})
+		}),
+		ScoreLeastCapacity: ScoreFunc(func(
+			t *storageprovider.Topology,
+			class *Class,
+			node *storageprovider.StorageNode,
+			pending PendingDevices,
+		) int64 {
+			return inverseScore(t, node, func(n *storageprovider.StorageNode) uint64 {
+				return nodeCapacity(n) + pending.size(n, class)
+			})
+		}),
+		ScoreLeastFree: ScoreFunc(func(
+			t *storageprovider.Topology,
+			class *Class,
+			node *storageprovider.StorageNode,
+			pending PendingDevices,
+		) int64 {
+			return inverseScore(t, node, func(n *storageprovider.StorageNode) uint64 {
+				return nodeFree(n) + pending.size(n, class)
+			})
+		}),
+		ScoreAffinity: ScoreFunc(func(
+			t *storageprovider.Topology,
+			class *Class,
+			node *storageprovider.StorageNode,
+			pending PendingDevices,
+		) int64 {
+			return int64(class.AffinityScore(node))
+		}),
+		ScoreSpread: ScoreFunc(func(
+			t *storageprovider.Topology,
+			class *Class,
+			node *storageprovider.StorageNode,
+			pending PendingDevices,
+		) int64 {
+			level := class.spreadLevel()
+			domain := node.Metadata.FailureDomain(level)
+			picked := 0
+			for n, count := range pending {
+				if n.Metadata.FailureDomain(level) == domain {
+					picked += count
+				}
+			}
+			return int64(MaxScore / (1 + picked))
+		}),
+	}
+
+	defaultScores = []WeightedScore{
+		{Name: ScoreLeastDevices, Weight: 1},
+		{Name: ScoreAffinity, Weight: 1},
+	}
+)
+
+// RegisterScore registers a score plugin which can then be used by
+// adding its name to Class.Scheduler.Scores
+func RegisterScore(name string, s ScorePlugin) error {
+	scoresLock.Lock()
+	defer scoresLock.Unlock()
+
+	if len(name) == 0 {
+		return fmt.Errorf("Score name must not be empty")
+	}
+	if s == nil {
+		return fmt.Errorf("Score %s is nil", name)
+	}
+	if _, ok := scores[name]; ok {
+		return fmt.Errorf("Score %s already registered", name)
+	}
+	scores[name] = s
+	return nil
+}
+
+// weightedPlugin is a score plugin with its configuration
+type weightedPlugin struct {
+	WeightedScore
+	plugin ScorePlugin
+}
+
+// getScores returns the score plugins configured for the class
+func getScores(class *Class) ([]weightedPlugin, error) {
+	scoresLock.Lock()
+	defer scoresLock.Unlock()
+
+	config := class.Scheduler.Scores
+	if len(config) == 0 {
+		config = defaultScores
+	}
+
+	plugins := make([]weightedPlugin, len(config))
+	for i, ws := range config {
+		s, ok := scores[ws.Name]
+		if !ok {
+			return nil, fmt.Errorf("Unknown score %s for class %s", ws.Name, class.Name)
+		}
+		plugins[i] = weightedPlugin{
+			WeightedScore: ws,
+			plugin:        s,
+		}
+	}
+	return plugins, nil
+}
+
+// scoreNodes returns the scores of the candidates
+func scoreNodes(
+	candidates []*storageprovider.StorageNode,
+	class *Class,
+	plugins []weightedPlugin,
+	pending PendingDevices,
+) map[*storageprovider.StorageNode]*NodeScore {
+	t := &storageprovider.Topology{
+		Cluster: storageprovider.StorageCluster{
+			StorageNodes: candidates,
+		},
+	}
+
+	results := make(map[*storageprovider.StorageNode]*NodeScore)
+	for _, node := range candidates {
+		result := &NodeScore{
+			Node:   node,
+			Scores: make(map[string]int64),
+		}
+		for _, p := range plugins {
+			score := p.Weight * p.plugin.Score(t, class, node, pending)
+			result.Scores[p.Name] = score
+			result.Total += score
+		}
+		results[node] = result
+	}
+	return results
+}
+
+// inverseScore returns MaxScore for the nodes with the lowest value down
+// to zero for the nodes with the highest value
+func inverseScore(
+	t *storageprovider.Topology,
+	node *storageprovider.StorageNode,
+	value func(*storageprovider.StorageNode) uint64,
+) int64 {
+	var max uint64
+	for _, n := range t.Cluster.StorageNodes {
+		if v := value(n); v > max {
+			max = v
+		}
+	}
+	if max == 0 {
+		return MaxScore
+	}
+	return int64(MaxScore * (max - value(node)) / max)
+}
+
+// scheduler places devices on the nodes with the highest total score
+type scheduler struct{}
+
+func (s *scheduler) Place(
+	t *storageprovider.Topology,
+	class *Class,
+) ([]*storageprovider.StorageNode, error) {
+	filterPlugins, err := getFilters(class.Scheduler.Filters)
+	if err != nil {
+		return nil, err
+	}
+	scorePlugins, err := getScores(class)
+	if err != nil {
+		return nil, err
+	}
+
+	nodes, reasons := filterNodes(t, class, filterPlugins)
+	if len(nodes) == 0 {
+		if len(t.Cluster.StorageNodes) == 0 {
+			return nil, fmt.Errorf("Cluster has no storage nodes")
+		}
+		return nil, fmt.Errorf("No storage nodes passed the filters of class %s: %v",
+			class.Name,
+			reasons[t.Cluster.StorageNodes[0]])
+	}
+
+	filtered := &storageprovider.Topology{
+		Cluster: storageprovider.StorageCluster{
+			StorageNodes: nodes,
+			Private:      t.Cluster.Private,
+		},
+	}
+	return pickNodes(filtered, class, func(
+		candidates []*storageprovider.StorageNode,
+		pending PendingDevices,
+	) nodeCompare {
+		results := scoreNodes(candidates, class, scorePlugins, pending)
+		return func(a, b *storageprovider.StorageNode) bool {
+			return results[a].Total > results[b].Total
+		}
+	})
+}
+
+// ScoreNodes runs the scheduler of the class against the current
+// topology and returns the result for every node, in topology order.
+// Nodes removed by a filter have their Reason set and no scores.
+func (m *Manager) ScoreNodes(className string) ([]*NodeScore, error) {
+	class, err := m.class(className)
+	if err != nil {
+		return nil, err
+	}
+
+	t, err := m.storage.GetTopology()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get topology: %v", err)
+	}
+
+	names := make([]string, 0, len(defaultFilters)+len(class.Scheduler.Filters))
+	names = append(names, defaultFilters...)
+	names = append(names, class.Scheduler.Filters...)
+	filterPlugins, err := getFilters(names)
+	if err != nil {
+		return nil, err
+	}
+	scorePlugins, err := getScores(class)
+	if err != nil {
+		return nil, err
+	}
+
+	nodes, reasons := filterNodes(t, class, filterPlugins)
+	candidates := make([]*storageprovider.StorageNode, 0, len(nodes))
+	for _, node := range nodes {
+		c, err := m.cloud.AttachmentCapacity(node.Metadata.ID)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to get attachment capacity of node %s: %v",
+				node.Metadata.ID,
+				err)
+		}
+		if c == 0 {
+			reasons[node] = fmt.Errorf("Node %s cannot attach more devices",
+				node.Metadata.ID)
+			continue
+		}
+		candidates = append(candidates, node)
+	}
+
+	results := scoreNodes(candidates, class, scorePlugins, PendingDevices{})
+	list := make([]*NodeScore, 0, len(t.Cluster.StorageNodes))
+	for _, node := range t.Cluster.StorageNodes {
+		if result, ok := results[node]; ok {
+			list = append(list, result)
+		} else {
+			list = append(list, &NodeScore{
+				Node:   node,
+				Reason: reasons[node].Error(),
+			})
+		}
+	}
+	return list, nil
+}
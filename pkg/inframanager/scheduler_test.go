@@ -0,0 +1,104 @@
+/*
+Package inframanager provides an interface to the infrastrcture manager
+Copyright 2018 Portworx
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package inframanager
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	cloudfake "github.com/libopenstorage/rico/pkg/cloudprovider/fake"
+	"github.com/libopenstorage/rico/pkg/storageprovider"
+	"github.com/libopenstorage/rico/pkg/storageprovider/fake"
+)
+
+func TestSchedulerPlacement(t *testing.T) {
+	assert.NoError(t, RegisterFilter("test-nodrain", FilterFunc(func(
+		t *storageprovider.Topology,
+		class *Class,
+		node *storageprovider.StorageNode,
+	) error {
+		if node.Labels["drain"] == "true" {
+			return fmt.Errorf("Node %s is draining", node.Metadata.ID)
+		}
+		return nil
+	})))
+	defer func() {
+		filtersLock.Lock()
+		defer filtersLock.Unlock()
+		delete(filters, "test-nodrain")
+	}()
+	assert.Error(t, RegisterFilter(FilterClass, FilterFunc(nil)))
+	assert.Error(t, RegisterScore(ScoreSpread, ScoreFunc(nil)))
+
+	nodes := newTestNodes("i-1", "i-2", "i-3", "i-4")
+	nodes[0].Metadata.Zone = "a"
+	nodes[1].Metadata.Zone = "a"
+	nodes[2].Metadata.Zone = "b"
+	nodes[3].Metadata.Zone = "b"
+	nodes[0].Devices = []*storageprovider.Device{{Size: 8}}
+	nodes[2].Devices = []*storageprovider.Device{{Size: 100}}
+	nodes[3].Labels = map[string]string{"drain": "true"}
+	storage := fake.New(&storageprovider.Topology{
+		Cluster: storageprovider.StorageCluster{
+			StorageNodes: nodes,
+		},
+	})
+	class := Class{
+		Name:          "gp2",
+		WatermarkHigh: 75,
+		DiskSets:      2,
+		DiskSizeGb:    8,
+		Placement:     PlacementScheduler,
+		Scheduler: SchedulerConfig{
+			Filters: []string{"test-nodrain"},
+			Scores: []WeightedScore{
+				{Name: ScoreLeastCapacity, Weight: 1},
+				{Name: ScoreSpread, Weight: 2},
+			},
+		},
+	}
+	assert.NoError(t, class.validate())
+	im := NewManager(&Config{Classes: []Class{class}}, cloudfake.New(), storage)
+
+	scores, err := im.ScoreNodes("gp2")
+	assert.NoError(t, err)
+	assert.Len(t, scores, 4)
+	assert.Equal(t, int64(92+200), scores[0].Total)
+	assert.Equal(t, int64(100+200), scores[1].Total)
+	assert.Equal(t, int64(0+200), scores[2].Total)
+	assert.Equal(t, map[string]int64{
+		ScoreLeastCapacity: 0,
+		ScoreSpread:        200,
+	}, scores[2].Scores)
+	assert.Contains(t, scores[3].Reason, "draining")
+
+	// Spread outweighs capacity for the second device of the set
+	storage.CurrentUtilization = 80
+	assert.NoError(t, im.do(&class))
+	assert.Len(t, nodes[0].Devices, 1)
+	assert.Len(t, nodes[1].Devices, 1)
+	assert.Len(t, nodes[2].Devices, 2)
+	assert.Len(t, nodes[3].Devices, 0)
+
+	_, err = im.ScoreNodes("unknown")
+	assert.Error(t, err)
+
+	class.Scheduler.Scores = []WeightedScore{{Name: "unknown", Weight: 1}}
+	assert.Error(t, class.validate())
+}
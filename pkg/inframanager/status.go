@@ -0,0 +1,127 @@
+/*
+Package inframanager provides an interface to the infrastrcture manager
+Copyright 2018 Portworx
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package inframanager
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/libopenstorage/rico/pkg/storageprovider"
+)
+
+var (
+	// ErrAttachmentSaturated is returned when none of the nodes which
+	// support a class can attach another device
+	ErrAttachmentSaturated = errors.New("cluster is attachment-saturated")
+)
+
+// ClassStatus reports the state of the manager for a class
+type ClassStatus struct {
+	// AttachmentSaturated is true when the last attempt to add storage
+	// found that no node could attach another device
+	AttachmentSaturated bool
+
+	// LastScaleUp is the last time storage was added
+	LastScaleUp time.Time
+
+	// LastScaleDown is the last time storage was removed
+	LastScaleDown time.Time
+
+	// TimeToFull is how long until the class is projected to be full
+	// when predictive scaling is enabled. It is negative when
+	// utilization is not growing or there is not enough history.
+	TimeToFull time.Duration
+
+	// Limit describes the bound of the class which stopped the last
+	// plan short. It is empty if no limit was reached.
+	Limit string
+
+	// PendingPlan is the ID of the plan waiting for approval
+	PendingPlan string
+
+	// RejectedUntil is when the class proposes plans again after its
+	// last plan was rejected
+	RejectedUntil time.Time
+
+	// Draining lists the devices being removed by the storage system
+	Draining []Drain
+}
+
+// classState is the state kept by the manager for each class
+type classState struct {
+	lock   sync.Mutex
+	status ClassStatus
+
+	// Number of consecutive samples beyond each watermark
+	highSamples int
+	lowSamples  int
+
+	// Utilization samples for predictive scaling
+	history utilizationHistory
+
+	// Plan waiting for approval
+	pending *PendingPlan
+
+	// Devices being drained, by device ID
+	drains map[string]*Drain
+
+	// Devices of the class on each known node, by instance ID
+	nodes map[string][]*storageprovider.Device
+}
+
+// Status returns the current status of the class
+func (m *Manager) Status(class string) (*ClassStatus, error) {
+	m.statesLock.Lock()
+	state, ok := m.states[class]
+	m.statesLock.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("Unknown class %s", class)
+	}
+
+	state.lock.Lock()
+	defer state.lock.Unlock()
+	status := state.status
+	status.Draining = state.drainList()
+	return &status, nil
+}
+
+// state returns the state of the class, creating it if needed
+func (m *Manager) state(class *Class) *classState {
+	m.statesLock.Lock()
+	defer m.statesLock.Unlock()
+
+	state, ok := m.states[class.Name]
+	if !ok {
+		state = &classState{}
+		m.states[class.Name] = state
+	}
+	return state
+}
+
+// classStates returns the state of every class
+func (m *Manager) classStates() []*classState {
+	m.statesLock.Lock()
+	defer m.statesLock.Unlock()
+
+	states := make([]*classState, 0, len(m.states))
+	for _, state := range m.states {
+		states = append(states, state)
+	}
+	return states
+}
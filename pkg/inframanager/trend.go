@@ -0,0 +1,191 @@
+/*
+Package inframanager provides an interface to the infrastrcture manager
+Copyright 2018 Portworx
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package inframanager
+
+import (
+	"fmt"
+	"time"
+)
+
+// TrendModel is the model used to project utilization
+type TrendModel string
+
+const (
+	// TrendNone disables predictive scaling
+	TrendNone TrendModel = ""
+
+	// TrendLinear fits a least squares line to the utilization history
+	TrendLinear TrendModel = "linear"
+
+	// TrendExponential applies double exponential smoothing to the
+	// utilization history, giving more weight to recent samples
+	TrendExponential TrendModel = "exponential"
+)
+
+const (
+	defaultHistorySize = 60
+	defaultAlpha       = 0.5
+	defaultBeta        = 0.3
+)
+
+// PredictiveConfig configures predictive scaling for a class
+type PredictiveConfig struct {
+	// Model used to project utilization. Defaults to TrendNone.
+	Model TrendModel
+
+	// LeadTime adds storage when utilization is projected to cross
+	// WatermarkHigh within this long
+	LeadTime time.Duration
+
+	// HistorySize is the number of samples kept. Defaults to 60.
+	HistorySize int
+
+	// Alpha is the level smoothing factor of TrendExponential, between
+	// 0 and 1. Defaults to 0.5.
+	Alpha float64
+
+	// Beta is the trend smoothing factor of TrendExponential, between
+	// 0 and 1. Defaults to 0.3.
+	Beta float64
+}
+
+func (p *PredictiveConfig) validate() error {
+	switch p.Model {
+	case TrendNone, TrendLinear, TrendExponential:
+	default:
+		return fmt.Errorf("Unknown trend model %s", p.Model)
+	}
+	if p.Alpha < 0 || p.Alpha > 1 || p.Beta < 0 || p.Beta > 1 {
+		return fmt.Errorf("Smoothing factors must be between 0 and 1")
+	}
+	return nil
+}
+
+// utilizationSample is a utilization value at a point in time
+type utilizationSample struct {
+	time        time.Time
+	utilization float64
+}
+
+// trend is the projection of utilization
+type trend struct {
+	// Current utilization according to the model
+	level float64
+
+	// Change of utilization per second
+	slope float64
+}
+
+// timeTo returns how long until the projected utilization reaches the
+// value. A negative duration is returned if it is never reached.
+func (t *trend) timeTo(value float64) time.Duration {
+	if t.level >= value {
+		return 0
+	}
+	if t.slope <= 0 {
+		return -1
+	}
+	return time.Duration((value - t.level) / t.slope * float64(time.Second))
+}
+
+// utilizationHistory keeps the utilization samples of a class
+type utilizationHistory struct {
+	samples []utilizationSample
+}
+
+// record adds a sample to the history, keeping at most size samples
+func (h *utilizationHistory) record(sample utilizationSample, size int) {
+	if size <= 0 {
+		size = defaultHistorySize
+	}
+	h.samples = append(h.samples, sample)
+	if len(h.samples) > size {
+		h.samples = h.samples[len(h.samples)-size:]
+	}
+}
+
+// fit returns the trend of the history according to the model. It returns
+// false if there are not enough samples.
+func (h *utilizationHistory) fit(config *PredictiveConfig) (*trend, bool) {
+	if len(h.samples) < 2 {
+		return nil, false
+	}
+
+	switch config.Model {
+	case TrendLinear:
+		return h.fitLinear()
+	case TrendExponential:
+		return h.fitExponential(config)
+	}
+	return nil, false
+}
+
+// fitLinear returns the least squares line through the samples
+func (h *utilizationHistory) fitLinear() (*trend, bool) {
+	start := h.samples[0].time
+	n := float64(len(h.samples))
+	var sumX, sumY, sumXY, sumXX float64
+	for _, s := range h.samples {
+		x := s.time.Sub(start).Seconds()
+		sumX += x
+		sumY += s.utilization
+		sumXY += x * s.utilization
+		sumXX += x * x
+	}
+
+	denominator := n*sumXX - sumX*sumX
+	if denominator == 0 {
+		return nil, false
+	}
+	slope := (n*sumXY - sumX*sumY) / denominator
+	intercept := (sumY - slope*sumX) / n
+	last := h.samples[len(h.samples)-1].time.Sub(start).Seconds()
+
+	return &trend{
+		level: intercept + slope*last,
+		slope: slope,
+	}, true
+}
+
+// fitExponential applies Holt's double exponential smoothing to the samples
+func (h *utilizationHistory) fitExponential(config *PredictiveConfig) (*trend, bool) {
+	alpha := config.Alpha
+	if alpha == 0 {
+		alpha = defaultAlpha
+	}
+	beta := config.Beta
+	if beta == 0 {
+		beta = defaultBeta
+	}
+
+	level := h.samples[0].utilization
+	slope := 0.0
+	for i := 1; i < len(h.samples); i++ {
+		dt := h.samples[i].time.Sub(h.samples[i-1].time).Seconds()
+		if dt <= 0 {
+			continue
+		}
+		previous := level
+		level = alpha*h.samples[i].utilization + (1-alpha)*(level+slope*dt)
+		slope = beta*(level-previous)/dt + (1-beta)*slope
+	}
+
+	return &trend{
+		level: level,
+		slope: slope,
+	}, true
+}
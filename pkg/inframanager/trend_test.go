@@ -0,0 +1,110 @@
+/*
+Package inframanager provides an interface to the infrastrcture manager
+Copyright 2018 Portworx
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package inframanager
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	cloudfake "github.com/libopenstorage/rico/pkg/cloudprovider/fake"
+	"github.com/libopenstorage/rico/pkg/storageprovider"
+	"github.com/libopenstorage/rico/pkg/storageprovider/fake"
+)
+
+func TestTrendFit(t *testing.T) {
+	start := time.Now()
+	h := &utilizationHistory{}
+	for i := 0; i < 10; i++ {
+		h.record(utilizationSample{
+			time:        start.Add(time.Duration(i) * time.Minute),
+			utilization: float64(10 + i),
+		}, 5)
+	}
+	assert.Len(t, h.samples, 5)
+
+	// One percent per minute
+	linear, ok := h.fit(&PredictiveConfig{Model: TrendLinear})
+	assert.True(t, ok)
+	assert.InDelta(t, 19, linear.level, 0.001)
+	assert.InDelta(t, 1.0/60, linear.slope, 0.0001)
+	assert.InDelta(t, float64(81*time.Minute), float64(linear.timeTo(100)), float64(time.Second))
+	assert.Equal(t, time.Duration(0), linear.timeTo(10))
+
+	exponential, ok := h.fit(&PredictiveConfig{Model: TrendExponential})
+	assert.True(t, ok)
+	assert.True(t, exponential.slope > 0)
+	assert.True(t, exponential.level > 15)
+
+	// Flat utilization never fills up
+	flat := &utilizationHistory{}
+	for i := 0; i < 3; i++ {
+		flat.record(utilizationSample{
+			time:        start.Add(time.Duration(i) * time.Minute),
+			utilization: 50,
+		}, 0)
+	}
+	tr, ok := flat.fit(&PredictiveConfig{Model: TrendLinear})
+	assert.True(t, ok)
+	assert.True(t, tr.timeTo(100) < 0)
+
+	_, ok = (&utilizationHistory{}).fit(&PredictiveConfig{Model: TrendLinear})
+	assert.False(t, ok)
+}
+
+func TestPredictiveScaling(t *testing.T) {
+	storage := fake.New(&storageprovider.Topology{
+		Cluster: storageprovider.StorageCluster{
+			StorageNodes: newTestNodes("i-1"),
+		},
+	})
+	class := Class{
+		Name:          "gp2",
+		WatermarkHigh: 75,
+		WatermarkLow:  25,
+		DiskSets:      1,
+		DiskSizeGb:    8,
+		Predictive: PredictiveConfig{
+			Model:    TrendLinear,
+			LeadTime: 10 * time.Minute,
+		},
+	}
+	assert.NoError(t, class.validate())
+	im := NewManager(&Config{Classes: []Class{class}}, cloudfake.New(), storage)
+	now := time.Now()
+	im.now = func() time.Time { return now }
+
+	// Growing one percent per minute
+	for _, u := range []int{50, 51, 52, 53, 54, 55, 56, 57, 58, 59, 60, 61, 62, 63, 64} {
+		storage.CurrentUtilization = u
+		assert.NoError(t, im.do(&class))
+		assert.Equal(t, 0, storage.NumDevices(), u)
+		now = now.Add(time.Minute)
+	}
+	status, err := im.Status("gp2")
+	assert.NoError(t, err)
+	assert.InDelta(t, float64(36*time.Minute), float64(status.TimeToFull), float64(time.Second))
+
+	// Ten minutes away from the watermark
+	storage.CurrentUtilization = 65
+	assert.NoError(t, im.do(&class))
+	assert.Equal(t, 1, storage.NumDevices())
+
+	class.Predictive.Model = "quadratic"
+	assert.Error(t, class.validate())
+}
@@ -0,0 +1,79 @@
+/*
+Package storageprovider provides an interface to storage providers
+Copyright 2018 Portworx
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package storageprovider
+
+import (
+	"time"
+)
+
+// EventType is the kind of change reported by the storage system
+type EventType string
+
+const (
+	// EventNodeAdded is sent when a node joins the storage system
+	EventNodeAdded EventType = "nodeadded"
+
+	// EventNodeRemoved is sent when a node leaves the storage system
+	EventNodeRemoved EventType = "noderemoved"
+
+	// EventDeviceAdded is sent when a device is in use by the storage
+	// system
+	EventDeviceAdded EventType = "deviceadded"
+
+	// EventDeviceFailed is sent when a device is no longer usable
+	EventDeviceFailed EventType = "devicefailed"
+
+	// EventDeviceDrained is sent when the data has been moved off a
+	// device being removed
+	EventDeviceDrained EventType = "devicedrained"
+
+	// EventUtilizationChanged is sent when the utilization of the storage
+	// system or of a class changes significantly
+	EventUtilizationChanged EventType = "utilizationchanged"
+
+	// EventRebalanceStarted is sent when the storage system starts
+	// moving data between devices
+	EventRebalanceStarted EventType = "rebalancestarted"
+
+	// EventRebalanceFinished is sent when the storage system has
+	// finished moving data between devices
+	EventRebalanceFinished EventType = "rebalancefinished"
+)
+
+// Event is a change in the storage system
+type Event struct {
+	Type EventType
+
+	// Time of the change
+	Time time.Time
+
+	// InstanceID of the node, if the event is about a node or device
+	InstanceID string
+
+	// DeviceID of the cloud device, if the event is about a device
+	DeviceID string
+
+	// Class whose utilization changed. Empty for the whole storage
+	// system.
+	Class string
+
+	// Utilization as a percentage number, for utilization changes
+	Utilization int
+
+	// Message describes the event
+	Message string
+}
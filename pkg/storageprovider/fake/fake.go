@@ -18,16 +18,41 @@ limitations under the License.
 package fake
 
 import (
+	"fmt"
+	"sync"
+
 	"github.com/libopenstorage/rico/pkg/storageprovider"
 	"github.com/lpabon/godbc"
 )
 
 // This is for tests only
 
+const (
+	// Number of events kept for each subscriber
+	eventsBuffer = 16
+)
+
 // Fake is an memory-only implementation of the storageprovider.Interface
 type Fake struct {
 	CurrentUtilization int
 	Topology           *storageprovider.Topology
+
+	// CurrentClassUtilization has the utilization of each class. Classes
+	// which are not present return storageprovider.ErrNotSupported.
+	CurrentClassUtilization map[string]int
+
+	// AddError is returned by DeviceAdd when set
+	AddError error
+
+	// AsyncRemove keeps removed devices in the topology until
+	// FinishRemove is called
+	AsyncRemove bool
+
+	// Removals has the status of the devices being removed
+	Removals map[string]*storageprovider.RemoveStatus
+
+	lock        sync.Mutex
+	subscribers []chan *storageprovider.Event
 }
 
 // New returns a new Fake storage implementation
@@ -48,11 +73,23 @@ func (f *Fake) Utilization() (int, error) {
 	return f.CurrentUtilization, nil
 }
 
+// ClassUtilization returns the current utilization of the class
+func (f *Fake) ClassUtilization(class string) (int, error) {
+	utilization, ok := f.CurrentClassUtilization[class]
+	if !ok {
+		return 0, storageprovider.ErrNotSupported
+	}
+	return utilization, nil
+}
+
 // DeviceAdd adds a device to the topology
 func (f *Fake) DeviceAdd(
 	node *storageprovider.StorageNode,
 	device *storageprovider.Device,
 ) error {
+	if f.AddError != nil {
+		return f.AddError
+	}
 
 	found := false
 	for _, sn := range f.Topology.Cluster.StorageNodes {
@@ -70,27 +107,117 @@ func (f *Fake) DeviceAdd(
 	return nil
 }
 
-// DeviceRemove removes a device from the topology
+// DeviceRemove removes a device from the topology. If AsyncRemove is
+// set, the device is only removed when FinishRemove is called.
 func (f *Fake) DeviceRemove(
 	node *storageprovider.StorageNode,
 	device *storageprovider.Device,
+) error {
+	if f.AsyncRemove {
+		godbc.Ensure(f.findDevice(node.Metadata.ID, device.Metadata.ID) != nil)
+		if f.Removals == nil {
+			f.Removals = make(map[string]*storageprovider.RemoveStatus)
+		}
+		f.Removals[device.Metadata.ID] = &storageprovider.RemoveStatus{
+			State: storageprovider.RemoveInProgress,
+		}
+		return nil
+	}
+
+	godbc.Ensure(f.removeDevice(node.Metadata.ID, device.Metadata.ID) == true)
+	return nil
+}
+
+// DeviceRemoveStatus returns the status of the removal of the device
+func (f *Fake) DeviceRemoveStatus(
+	node *storageprovider.StorageNode,
+	device *storageprovider.Device,
+) (*storageprovider.RemoveStatus, error) {
+	if status, ok := f.Removals[device.Metadata.ID]; ok {
+		s := *status
+		return &s, nil
+	}
+	if f.findDevice(node.Metadata.ID, device.Metadata.ID) == nil {
+		return &storageprovider.RemoveStatus{
+			State:    storageprovider.RemoveDone,
+			Progress: 100,
+		}, nil
+	}
+	return nil, fmt.Errorf("Device %s is not being removed", device.Metadata.ID)
+}
+
+// DeviceRemoveAbort stops the removal of the device
+func (f *Fake) DeviceRemoveAbort(
+	node *storageprovider.StorageNode,
+	device *storageprovider.Device,
+) error {
+	status, ok := f.Removals[device.Metadata.ID]
+	if !ok || status.State != storageprovider.RemoveInProgress {
+		return fmt.Errorf("Device %s is not being removed", device.Metadata.ID)
+	}
+	delete(f.Removals, device.Metadata.ID)
+	return nil
+}
+
+// FinishRemove completes the removal of a device started while
+// AsyncRemove is set
+func (f *Fake) FinishRemove(deviceID string) {
+	for _, sn := range f.Topology.Cluster.StorageNodes {
+		if f.removeDevice(sn.Metadata.ID, deviceID) {
+			break
+		}
+	}
+	f.Removals[deviceID] = &storageprovider.RemoveStatus{
+		State:    storageprovider.RemoveDone,
+		Progress: 100,
+	}
+}
+
+func (f *Fake) findDevice(nodeID, deviceID string) *storageprovider.Device {
+	for _, sn := range f.Topology.Cluster.StorageNodes {
+		if sn.Metadata.ID != nodeID {
+			continue
+		}
+		for _, d := range sn.Devices {
+			if d.Metadata.ID == deviceID {
+				return d
+			}
+		}
+	}
+	return nil
+}
+
+func (f *Fake) removeDevice(nodeID, deviceID string) bool {
+	for _, sn := range f.Topology.Cluster.StorageNodes {
+		if sn.Metadata.ID != nodeID {
+			continue
+		}
+		for i, d := range sn.Devices {
+			if d.Metadata.ID == deviceID {
+				sn.Devices[i] = sn.Devices[len(sn.Devices)-1]
+				sn.Devices = sn.Devices[:len(sn.Devices)-1]
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// DeviceExpanded updates the size of the device in the topology
+func (f *Fake) DeviceExpanded(
+	node *storageprovider.StorageNode,
+	device *storageprovider.Device,
 ) error {
 	found := false
 	for _, sn := range f.Topology.Cluster.StorageNodes {
 		if sn.Metadata.ID == node.Metadata.ID {
-			index := 0
-			for i, d := range sn.Devices {
+			for _, d := range sn.Devices {
 				if d.Metadata.ID == device.Metadata.ID {
 					found = true
-					index = i
+					d.Size = device.Size
 					break
 				}
 			}
-
-			if found {
-				sn.Devices[index] = sn.Devices[len(sn.Devices)-1]
-				sn.Devices = sn.Devices[:len(sn.Devices)-1]
-			}
 		}
 	}
 	godbc.Ensure(found == true)
@@ -106,7 +233,26 @@ func (f *Fake) NumDevices() int {
 	return devices
 }
 
-// Event :TODO:
-func (f *Fake) Event() {
+// Events returns a channel which receives the events sent by Publish
+func (f *Fake) Events() (<-chan *storageprovider.Event, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	events := make(chan *storageprovider.Event, eventsBuffer)
+	f.subscribers = append(f.subscribers, events)
+	return events, nil
+}
+
+// Publish sends the event to the channels returned by Events. The event
+// is dropped for subscribers which are not keeping up.
+func (f *Fake) Publish(event *storageprovider.Event) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
 
+	for _, events := range f.subscribers {
+		select {
+		case events <- event:
+		default:
+		}
+	}
 }
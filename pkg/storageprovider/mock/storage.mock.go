@@ -33,6 +33,19 @@ func (m *MockInterface) EXPECT() *MockInterfaceMockRecorder {
 	return m.recorder
 }
 
+// ClassUtilization mocks base method
+func (m *MockInterface) ClassUtilization(arg0 string) (int, error) {
+	ret := m.ctrl.Call(m, "ClassUtilization", arg0)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ClassUtilization indicates an expected call of ClassUtilization
+func (mr *MockInterfaceMockRecorder) ClassUtilization(arg0 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ClassUtilization", reflect.TypeOf((*MockInterface)(nil).ClassUtilization), arg0)
+}
+
 // DeviceAdd mocks base method
 func (m *MockInterface) DeviceAdd(arg0 *storageprovider.StorageNode, arg1 *storageprovider.Device) error {
 	ret := m.ctrl.Call(m, "DeviceAdd", arg0, arg1)
@@ -45,6 +58,18 @@ func (mr *MockInterfaceMockRecorder) DeviceAdd(arg0, arg1 interface{}) *gomock.C
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeviceAdd", reflect.TypeOf((*MockInterface)(nil).DeviceAdd), arg0, arg1)
 }
 
+// DeviceExpanded mocks base method
+func (m *MockInterface) DeviceExpanded(arg0 *storageprovider.StorageNode, arg1 *storageprovider.Device) error {
+	ret := m.ctrl.Call(m, "DeviceExpanded", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeviceExpanded indicates an expected call of DeviceExpanded
+func (mr *MockInterfaceMockRecorder) DeviceExpanded(arg0, arg1 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeviceExpanded", reflect.TypeOf((*MockInterface)(nil).DeviceExpanded), arg0, arg1)
+}
+
 // DeviceRemove mocks base method
 func (m *MockInterface) DeviceRemove(arg0 *storageprovider.StorageNode, arg1 *storageprovider.Device) error {
 	ret := m.ctrl.Call(m, "DeviceRemove", arg0, arg1)
@@ -57,14 +82,42 @@ func (mr *MockInterfaceMockRecorder) DeviceRemove(arg0, arg1 interface{}) *gomoc
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeviceRemove", reflect.TypeOf((*MockInterface)(nil).DeviceRemove), arg0, arg1)
 }
 
-// Event mocks base method
-func (m *MockInterface) Event() {
-	m.ctrl.Call(m, "Event")
+// DeviceRemoveAbort mocks base method
+func (m *MockInterface) DeviceRemoveAbort(arg0 *storageprovider.StorageNode, arg1 *storageprovider.Device) error {
+	ret := m.ctrl.Call(m, "DeviceRemoveAbort", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeviceRemoveAbort indicates an expected call of DeviceRemoveAbort
+func (mr *MockInterfaceMockRecorder) DeviceRemoveAbort(arg0, arg1 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeviceRemoveAbort", reflect.TypeOf((*MockInterface)(nil).DeviceRemoveAbort), arg0, arg1)
+}
+
+// DeviceRemoveStatus mocks base method
+func (m *MockInterface) DeviceRemoveStatus(arg0 *storageprovider.StorageNode, arg1 *storageprovider.Device) (*storageprovider.RemoveStatus, error) {
+	ret := m.ctrl.Call(m, "DeviceRemoveStatus", arg0, arg1)
+	ret0, _ := ret[0].(*storageprovider.RemoveStatus)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DeviceRemoveStatus indicates an expected call of DeviceRemoveStatus
+func (mr *MockInterfaceMockRecorder) DeviceRemoveStatus(arg0, arg1 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeviceRemoveStatus", reflect.TypeOf((*MockInterface)(nil).DeviceRemoveStatus), arg0, arg1)
+}
+
+// Events mocks base method
+func (m *MockInterface) Events() (<-chan *storageprovider.Event, error) {
+	ret := m.ctrl.Call(m, "Events")
+	ret0, _ := ret[0].(<-chan *storageprovider.Event)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
 }
 
-// Event indicates an expected call of Event
-func (mr *MockInterfaceMockRecorder) Event() *gomock.Call {
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Event", reflect.TypeOf((*MockInterface)(nil).Event))
+// Events indicates an expected call of Events
+func (mr *MockInterfaceMockRecorder) Events() *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Events", reflect.TypeOf((*MockInterface)(nil).Events))
 }
 
 // GetTopology mocks base method
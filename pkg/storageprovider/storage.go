@@ -17,10 +17,28 @@ limitations under the License.
 //go:generate mockgen -package=mock -destination=mock/storage.mock.go github.com/libopenstorage/rico/pkg/storageprovider Interface
 package storageprovider
 
+import (
+	"errors"
+	"time"
+)
+
+var (
+	// ErrNotSupported is returned when the storage provider does not
+	// support the request
+	ErrNotSupported = errors.New("Not supported")
+)
+
 // DeviceMetadata contains cloud metadata for the device
 type DeviceMetadata struct {
 	// Cloud volume id for this device
 	ID string
+
+	// Created is the time the cloud volume was created
+	Created time.Time
+
+	// Class is the name of the class the device was added for. Devices
+	// without a class are considered part of every class.
+	Class string
 }
 
 // Device contains information about the device of the storage system
@@ -41,13 +59,71 @@ type Device struct {
 	Private interface{}
 }
 
+// FailureDomainLevel is a level in the failure domain hierarchy
+type FailureDomainLevel string
+
+const (
+	// LevelRegion is the highest failure domain level
+	LevelRegion FailureDomainLevel = "region"
+
+	// LevelZone is a zone or availability zone within a region
+	LevelZone FailureDomainLevel = "zone"
+
+	// LevelRack is a rack within a zone
+	LevelRack FailureDomainLevel = "rack"
+
+	// LevelHost is a physical host within a rack
+	LevelHost FailureDomainLevel = "host"
+)
+
+// FailureDomainLevels lists the failure domain levels from highest
+// to lowest
+var FailureDomainLevels = []FailureDomainLevel{
+	LevelRegion,
+	LevelZone,
+	LevelRack,
+	LevelHost,
+}
+
 // InstanceMetadata contains cloud information about the instance
 type InstanceMetadata struct {
 	// ID is the cloud instance ID
 	ID string
 
+	// Region holds the region of the instance
+	Region string
+
 	// Zone holds cloud failure domain information
 	Zone string
+
+	// Rack holds the rack of the instance within the zone
+	Rack string
+
+	// Host holds the physical host of the instance within the rack.
+	// If not provided, each instance is considered its own host.
+	Host string
+}
+
+// FailureDomain returns the name of the failure domain of the instance at
+// the requested level. The name includes all the levels above it, so
+// racks with the same name in different zones are different domains.
+func (m *InstanceMetadata) FailureDomain(level FailureDomainLevel) string {
+	host := m.Host
+	if len(host) == 0 {
+		host = m.ID
+	}
+
+	switch level {
+	case LevelRegion:
+		return m.Region
+	case LevelZone:
+		return m.Region + "/" + m.Zone
+	case LevelRack:
+		return m.Region + "/" + m.Zone + "/" + m.Rack
+	case LevelHost:
+		return m.Region + "/" + m.Zone + "/" + m.Rack + "/" + host
+	}
+	return ""
 }
 
 // StorageNode defines information about the node
@@ -65,6 +141,9 @@ type StorageNode struct {
 	// it defaults to all
 	Classes []string
 
+	// Labels are key/value pairs used to target nodes
+	Labels map[string]string
+
 	// Private can be used by the storage system as a cookie
 	Private interface{}
 }
@@ -83,6 +162,33 @@ type Topology struct {
 	Cluster StorageCluster
 }
 
+// RemoveState is the state of the removal of a device
+type RemoveState string
+
+const (
+	// RemoveInProgress means data is still being moved off the device
+	RemoveInProgress RemoveState = "inprogress"
+
+	// RemoveDone means the device is no longer used by the storage
+	// system and can be detached
+	RemoveDone RemoveState = "done"
+
+	// RemoveFailed means the device could not be drained and is still
+	// used by the storage system
+	RemoveFailed RemoveState = "failed"
+)
+
+// RemoveStatus reports the progress of the removal of a device
+type RemoveStatus struct {
+	State RemoveState
+
+	// Progress of the drain as a percentage number
+	Progress int
+
+	// Message describes the failure when the removal failed
+	Message string
+}
+
 // Interface is a pluggable interface for storage providers
 type Interface interface {
 	// Topology returns the current topology and utilization of the storage system
@@ -91,12 +197,32 @@ type Interface interface {
 	// Utilization returns the total utilization of the storage system
 	Utilization() (int, error)
 
+	// ClassUtilization returns the utilization of the devices of a class.
+	// Providers which cannot break down utilization by class return
+	// ErrNotSupported.
+	ClassUtilization(class string) (int, error)
+
 	// DeviceAdd notifies the storage provider a new device has been added
 	DeviceAdd(*StorageNode, *Device) error
 
-	// DeviceRemove requests to remove a device from the storage system
+	// DeviceRemove requests to remove a device from the storage system.
+	// The storage system may need time to move the data off the device,
+	// which must not be detached until DeviceRemoveStatus reports that
+	// the removal is done.
 	DeviceRemove(*StorageNode, *Device) error
 
-	// Event handler TBD
-	Event( /* TBD */ )
+	// DeviceRemoveStatus returns the progress of the removal of a device
+	DeviceRemoveStatus(*StorageNode, *Device) (*RemoveStatus, error)
+
+	// DeviceRemoveAbort stops the removal of a device, which then stays
+	// in use by the storage system
+	DeviceRemoveAbort(*StorageNode, *Device) error
+
+	// DeviceExpanded notifies the storage provider a device has grown
+	// to the size of the device provided
+	DeviceExpanded(*StorageNode, *Device) error
+
+	// Events returns a channel which receives the changes in the storage
+	// system. Providers which do not send events return ErrNotSupported.
+	Events() (<-chan *Event, error)
 }
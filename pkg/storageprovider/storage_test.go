@@ -0,0 +1,40 @@
+/*
+Package storageprovider provides an interface to storage providers
+Copyright 2018 Portworx
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package storageprovider
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFailureDomain(t *testing.T) {
+	m := &InstanceMetadata{
+		ID:     "i-1",
+		Region: "us-east-1",
+		Zone:   "us-east-1a",
+		Rack:   "r1",
+	}
+	assert.Equal(t, "us-east-1", m.FailureDomain(LevelRegion))
+	assert.Equal(t, "us-east-1/us-east-1a", m.FailureDomain(LevelZone))
+	assert.Equal(t, "us-east-1/us-east-1a/r1", m.FailureDomain(LevelRack))
+	assert.Equal(t, "us-east-1/us-east-1a/r1/i-1", m.FailureDomain(LevelHost))
+
+	m.Host = "h1"
+	assert.Equal(t, "us-east-1/us-east-1a/r1/h1", m.FailureDomain(LevelHost))
+	assert.Empty(t, m.FailureDomain("unknown"))
+}